@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/boavizta/helloasso-renew-contribution/services/brevo"
+	"github.com/boavizta/helloasso-renew-contribution/services/helloasso"
+)
+
+// auditEmailField is the field of the entries recording a sent email
+const auditEmailField = "Email sent"
+
+// AuditLog records the changes applied by a run and the emails it sent, with
+// the run ID, in the Baserow "Membership audit" table (BASEROW_AUDIT_TABLE_ID)
+// and/or a local JSON lines file (AUDIT_LOG_FILE). Without either, nothing is
+// recorded. A nil audit log records nothing.
+type AuditLog struct {
+	RunId   string
+	file    string
+	baserow bool
+	pending []baserow.AuditEntry
+}
+
+// loadAuditLog returns the audit log of a new run
+func loadAuditLog(now time.Time) *AuditLog {
+	return &AuditLog{
+		RunId:   now.UTC().Format("20060102T150405Z") + "-" + randomHex(3),
+		file:    os.Getenv("AUDIT_LOG_FILE"),
+		baserow: os.Getenv("BASEROW_AUDIT_TABLE_ID") != "",
+	}
+}
+
+// Enabled reports whether the changes are recorded anywhere
+func (a *AuditLog) Enabled() bool {
+	return a != nil && (a.file != "" || a.baserow)
+}
+
+// Add stamps the entries with the run ID and the current time, they are
+// recorded by Flush
+func (a *AuditLog) Add(entries ...baserow.AuditEntry) {
+	if !a.Enabled() {
+		return
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		entry.RunId = a.RunId
+		entry.Time = now
+		a.pending = append(a.pending, entry)
+	}
+}
+
+// AddEmail records the named email sent to the member by the phase
+func (a *AuditLog) AddEmail(phase string, name string, email brevo.EmailData, member baserow.Member, payment helloasso.Payment) {
+	a.Add(baserow.AuditEntry{
+		MemberId: member.Id,
+		Email:    member.Email,
+		Field:    auditEmailField,
+		NewValue: name + " to " + strings.Join(append([]string{email.ToEmail}, email.Cc...), ", "),
+		Phase:    phase,
+		Payment:  auditPayment(payment),
+	})
+}
+
+// Flush appends the pending entries to the audit log
+func (a *AuditLog) Flush() error {
+	if !a.Enabled() || len(a.pending) == 0 {
+		return nil
+	}
+	entries := a.pending
+	a.pending = nil
+
+	if a.file != "" {
+		file, err := os.OpenFile(a.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log file: %w", err)
+		}
+		defer file.Close()
+
+		encoder := json.NewEncoder(file)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return fmt.Errorf("failed to write audit log file: %w", err)
+			}
+		}
+	}
+	if a.baserow {
+		return baserow.AddAuditEntries(entries)
+	}
+	return nil
+}
+
+// Entries returns the recorded entries of a member (by email) or of a run
+// (by run ID), from the local file when configured, else from Baserow
+func (a *AuditLog) Entries(email string, runId string) ([]baserow.AuditEntry, error) {
+	if a.file == "" {
+		if email != "" {
+			return baserow.GetAuditEntries("E-mail", email)
+		}
+		return baserow.GetAuditEntries("Run", runId)
+	}
+
+	file, err := os.Open(a.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log file: %w", err)
+	}
+	defer file.Close()
+
+	var entries []baserow.AuditEntry
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var entry baserow.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid audit log line %d: %w", line, err)
+		}
+		if (email != "" && strings.EqualFold(entry.Email, email)) || (runId != "" && entry.RunId == runId) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// auditPayment describes the payment matched by a phase, empty when none
+func auditPayment(payment helloasso.Payment) string {
+	if payment.PayerEmail == "" && payment.Key() == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s %s %.2f %s", payment.Key(), payment.OrderDate.Format("2006-01-02"), payment.Amount, payment.PayerEmail)
+}
+
+// runHistory prints the changes the runs made to a member
+func runHistory(args []string, logger *slog.Logger) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: history <email>")
+		return 2
+	}
+
+	audit := loadAuditLog(time.Now())
+	if !audit.Enabled() {
+		fmt.Fprintln(os.Stderr, "history requires AUDIT_LOG_FILE or BASEROW_AUDIT_TABLE_ID")
+		return 2
+	}
+
+	entries, err := audit.Entries(args[0], "")
+	if err != nil {
+		logger.Error("Error reading the audit log", "error", err)
+		return 1
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No recorded change for %s\n", args[0])
+		return 0
+	}
+
+	for _, entry := range entries {
+		line := fmt.Sprintf("%s  %s  %-20s %s: %s -> %s", entry.Time.Local().Format("2006-01-02 15:04"), entry.RunId, entry.Phase, entry.Field, auditValue(entry.OldValue), auditValue(entry.NewValue))
+		if entry.Payment != "" {
+			line += "  (payment " + entry.Payment + ")"
+		}
+		fmt.Println(line)
+	}
+	return 0
+}
+
+// auditValue formats a recorded value, "empty" for a cleared column
+func auditValue(value any) string {
+	if value == nil || value == "" {
+		return "empty"
+	}
+	return fmt.Sprint(value)
+}
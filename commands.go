@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/boavizta/helloasso-renew-contribution/services/helloasso"
+)
+
+// runCommand runs a subcommand instead of the reconciliation and returns the
+// process exit code
+func runCommand(name string, args []string, logger *slog.Logger) int {
+	switch name {
+	case "preview":
+		return runPreview(args, false, logger)
+	case "test-send":
+		return runPreview(args, true, logger)
+	case "history":
+		return runHistory(args, logger)
+	case "rollback":
+		return runRollback(args, logger)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, available commands: preview, test-send, history, rollback\n", name)
+		return 2
+	}
+}
+
+// runPreview renders a template for a Baserow member (or fake data) and
+// writes it to files or stdout, or with send set, sends it to a test address.
+func runPreview(args []string, send bool, logger *slog.Logger) int {
+	command := "preview"
+	if send {
+		command = "test-send"
+	}
+
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	templateName := flags.String("template", "renewal", "name of the email template to render")
+	memberId := flags.Int("member", 0, "Baserow ID of the member to render the template for, fake data when not set")
+	lang := flags.String("lang", "", "language of the template, the member language when not set")
+	outDir := flags.String("out", "", "directory to write the rendered files to, stdout when not set (preview only)")
+	to := flags.String("to", "", "address to send the rendered email to (test-send only)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if send && *to == "" {
+		fmt.Fprintln(os.Stderr, "test-send requires --to")
+		return 2
+	}
+
+	notifier, err := loadNotifier()
+	if err != nil {
+		logger.Error("Error loading email configuration", "error", err)
+		return 1
+	}
+
+	schedule, err := loadReminderSchedule(os.Getenv("REMINDER_SCHEDULE"), notifier)
+	if err != nil {
+		logger.Error("Error loading reminder schedule", "error", err)
+		return 1
+	}
+	notifier.Recipients, err = loadRecipientPolicy(schedule)
+	if err != nil {
+		logger.Error("Error loading recipient policy", "error", err)
+		return 1
+	}
+
+	member := previewMember()
+	if *memberId != 0 {
+		member, err = baserow.GetMember(*memberId)
+		if err != nil {
+			logger.Error("Error fetching member from Baserow", "error", err, "id", *memberId)
+			return 1
+		}
+	}
+	data := previewTemplateData(member)
+	if *lang == "" {
+		*lang = notifier.Languages.Resolve(member, data.Payment)
+	}
+
+	email, err := notifier.Email(member, *lang, *templateName, data)
+	if err != nil {
+		logger.Error("Error rendering email template", "error", err)
+		return 1
+	}
+
+	if send {
+		email.ToEmail = *to
+		email.Cc = nil
+		if email.Subject != "" {
+			email.Subject = "[TEST] " + email.Subject
+		}
+		email.Tags = append(email.Tags, "test")
+		if err := notifier.Mailer.Send(email); err != nil {
+			logger.Error("Error sending test email", "error", err, "to", *to)
+			return 1
+		}
+		logger.Info("Sent test email", "template", *templateName, "lang", *lang, "to", *to)
+		return 0
+	}
+
+	// Brevo templates are rendered by Brevo, only their params can be previewed
+	if email.TemplateId != 0 {
+		params, err := json.MarshalIndent(email.Params, "", "  ")
+		if err != nil {
+			logger.Error("Error encoding Brevo template params", "error", err)
+			return 1
+		}
+		if *outDir == "" {
+			fmt.Printf("Brevo template: %d\n\n--- params ---\n%s\n", email.TemplateId, params)
+			return 0
+		}
+		if err := os.MkdirAll(*outDir, 0o755); err != nil {
+			logger.Error("Error creating output directory", "error", err)
+			return 1
+		}
+		file := filepath.Join(*outDir, *templateName+"."+*lang+".params.json")
+		if err := os.WriteFile(file, append(params, '\n'), 0o644); err != nil {
+			logger.Error("Error writing preview file", "error", err, "file", file)
+			return 1
+		}
+		logger.Info("Wrote Brevo template params", "template", *templateName, "lang", *lang, "templateId", email.TemplateId, "file", file)
+		return 0
+	}
+
+	if *outDir == "" {
+		fmt.Printf("To: %s\nCc: %s\nSubject: %s\n\n--- text ---\n%s\n--- html ---\n%s\n", email.ToEmail, strings.Join(email.Cc, ", "), email.Subject, email.TextContent, email.HtmlContent)
+		return 0
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		logger.Error("Error creating output directory", "error", err)
+		return 1
+	}
+	base := filepath.Join(*outDir, *templateName+"."+*lang)
+	files := map[string]string{
+		base + ".subject.txt": email.Subject + "\n",
+		base + ".html":        email.HtmlContent,
+		base + ".txt":         email.TextContent,
+	}
+	for file, content := range files {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			logger.Error("Error writing preview file", "error", err, "file", file)
+			return 1
+		}
+	}
+	logger.Info("Wrote email preview", "template", *templateName, "lang", *lang, "files", base+".*")
+	return 0
+}
+
+// previewMember is the fake member used when no member ID is given
+func previewMember() baserow.Member {
+	return baserow.Member{
+		FirstName:        "camille",
+		Surname:          "Dupont",
+		Email:            "camille.dupont@example.org",
+		ActiveMembership: true,
+		LastPaymentDate:  time.Now().AddDate(0, -11, 0),
+		MembershipType:   IndividualTypeId,
+		Country:          "France",
+	}
+}
+
+// previewTemplateData builds the payment related variables from the member's
+// last payment, or a fake payment
+func previewTemplateData(member baserow.Member) TemplateData {
+	paymentDate := member.LastPaymentDate
+	if paymentDate.IsZero() {
+		paymentDate = time.Now().AddDate(0, -11, 0)
+	}
+	expiry := membershipExpiry(paymentDate)
+
+	return TemplateData{
+		Payment: helloasso.Payment{
+			OrderId:        123456,
+			OrderFormSlug:  "annual-membership-fee",
+			OrderDate:      paymentDate,
+			PayerEmail:     member.Email,
+			PayerFirstName: member.FirstName,
+			PayerLastName:  member.Surname,
+			Amount:         50,
+		},
+		ExpiryDate: expiry,
+		DaysLeft:   max(0, int(time.Until(expiry).Hours()/24)),
+	}
+}
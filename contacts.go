@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/boavizta/helloasso-renew-contribution/services/brevo"
+	"github.com/boavizta/helloasso-renew-contribution/services/helloasso"
+)
+
+// loadMembersListId returns the Brevo list mirroring the active members, or
+// 0 when the sync is disabled (BREVO_MEMBERS_LIST_ID not set)
+func loadMembersListId() (int, error) {
+	value := os.Getenv("BREVO_MEMBERS_LIST_ID")
+	if value == "" {
+		return 0, nil
+	}
+	listId, err := strconv.Atoi(value)
+	if err != nil || listId <= 0 {
+		return 0, fmt.Errorf("invalid BREVO_MEMBERS_LIST_ID %q", value)
+	}
+	return listId, nil
+}
+
+// syncMembersList mirrors the members into the Brevo list: active members are
+// created or updated with their attributes and added to the list, known
+// members who are inactive or opted out are removed from it. Contacts of the
+// list who are not members are left untouched.
+func syncMembersList(listId int, members []baserow.Member, paymentsByEmail map[string]helloasso.Payment, languages *LanguageResolver, logger *slog.Logger) error {
+	listEmails, err := brevo.GetListContacts(listId)
+	if err != nil {
+		return err
+	}
+	inList := map[string]bool{}
+	for _, email := range listEmails {
+		inList[strings.ToLower(email)] = true
+	}
+
+	var contacts []brevo.Contact
+	var removed []string
+	for _, member := range members {
+		address := memberAddress(member)
+		if member.ActiveMembership && address != "" {
+			payment, found := memberPayment(member, paymentsByEmail)
+			contacts = append(contacts, memberContact(member, address, payment, found, languages))
+		}
+
+		// Remove every address of the member that should not be in the list
+		for _, email := range memberEmails(member) {
+			if !inList[strings.ToLower(email)] {
+				continue
+			}
+			if !member.ActiveMembership || !strings.EqualFold(email, address) {
+				removed = append(removed, email)
+			}
+		}
+	}
+
+	if err := brevo.ImportContacts(listId, contacts); err != nil {
+		return err
+	}
+	if err := brevo.RemoveContactsFromList(listId, removed); err != nil {
+		return err
+	}
+
+	logger.Info("Finished syncing members to the Brevo list", "list", listId, "imported", len(contacts), "removed", len(removed))
+	return nil
+}
+
+// memberPayment returns the latest payment of the member, found by any of
+// their addresses
+func memberPayment(member baserow.Member, paymentsByEmail map[string]helloasso.Payment) (helloasso.Payment, bool) {
+	for _, email := range memberEmails(member) {
+		if payment, ok := paymentsByEmail[email]; ok {
+			return payment, true
+		}
+	}
+	return helloasso.Payment{}, false
+}
+
+// memberContact builds the Brevo contact of a member
+func memberContact(member baserow.Member, address string, payment helloasso.Payment, found bool, languages *LanguageResolver) brevo.Contact {
+	membershipType := "Individual"
+	if member.MembershipType == OrganizationTypeId {
+		membershipType = "Organization"
+	}
+
+	attributes := map[string]any{
+		"FIRSTNAME":       toCamelCase(member.FirstName),
+		"LASTNAME":        member.Surname,
+		"MEMBERSHIP_TYPE": membershipType,
+		"LANGUAGE":        languages.Resolve(member, payment),
+	}
+	if found {
+		attributes["MEMBERSHIP_TIER"] = membershipTier(member, payment)
+	}
+	if !member.LastPaymentDate.IsZero() {
+		attributes["MEMBERSHIP_EXPIRY"] = membershipExpiry(member.LastPaymentDate).Format("2006-01-02")
+	}
+
+	return brevo.Contact{Email: address, Attributes: attributes}
+}
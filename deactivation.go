@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/samber/lo"
+)
+
+// defaultMaxDeactivationPercent is the share of active members a run may
+// deactivate for lack of a recent payment
+const defaultMaxDeactivationPercent = 10
+
+// loadMaxDeactivationPercent reads MAX_DEACTIVATION_PERCENT, from 1 to 100
+func loadMaxDeactivationPercent() (int, error) {
+	value := os.Getenv("MAX_DEACTIVATION_PERCENT")
+	if value == "" {
+		return defaultMaxDeactivationPercent, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 || parsed > 100 {
+		return 0, fmt.Errorf("invalid MAX_DEACTIVATION_PERCENT %q, expected 1 to 100", value)
+	}
+	return parsed, nil
+}
+
+// checkDeactivations returns why the planned deactivations must not be
+// applied, or an empty string when they stay under maxPercent of the active
+// members. An empty or truncated payment source makes every member look
+// unpaid, so a large share of deactivations is more likely a bug than a fact.
+func checkDeactivations(planned []baserow.Member, members []baserow.Member, maxPercent int) string {
+	active := lo.CountBy(members, func(member baserow.Member) bool {
+		return member.ActiveMembership
+	})
+	if len(planned) == 0 || len(planned)*100 <= active*maxPercent {
+		return ""
+	}
+	return fmt.Sprintf("%d of %d active members (%d%%) would be deactivated, above MAX_DEACTIVATION_PERCENT=%d%%",
+		len(planned), active, len(planned)*100/max(active, 1), maxPercent)
+}
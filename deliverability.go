@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/boavizta/helloasso-renew-contribution/services/brevo"
+	"github.com/boavizta/helloasso-renew-contribution/services/helloasso"
+)
+
+// Brevo events making an address undeliverable, and events meaning the
+// member doesn't want our emails anymore
+var (
+	undeliverableEvents = []string{"hardBounces", "blocked", "invalid"}
+	optOutEvents        = []string{"spam", "unsubscribed"}
+)
+
+// defaultBrevoEventsDays is the number of days of Brevo events read each run
+const defaultBrevoEventsDays = 30
+
+// loadBrevoEventsDays returns the number of days of Brevo events to ingest,
+// or 0 when ingestion is disabled (INGEST_BREVO_EVENTS not "true").
+func loadBrevoEventsDays() (int, error) {
+	if os.Getenv("INGEST_BREVO_EVENTS") != "true" {
+		return 0, nil
+	}
+
+	days := defaultBrevoEventsDays
+	if value := os.Getenv("BREVO_EVENTS_DAYS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 90 {
+			return 0, fmt.Errorf("invalid BREVO_EVENTS_DAYS %q, expected 1 to 90", value)
+		}
+		days = parsed
+	}
+	return days, nil
+}
+
+// ingestDeliveryEvents records the Brevo bounces, blocks, spam complaints and
+// unsubscribes of the last days in the working state of the members. The
+// fetched members are left untouched.
+func ingestDeliveryEvents(members []baserow.Member, days int, states *MemberStates, logger *slog.Logger) error {
+	indexByEmail := map[string]int{}
+	for i, member := range members {
+		for _, email := range append(memberEmails(member), member.BillingEmail) {
+			if email != "" {
+				indexByEmail[strings.ToLower(email)] = i
+			}
+		}
+	}
+
+	changed := map[int]baserow.Member{}
+	for _, eventType := range append(slices.Clone(undeliverableEvents), optOutEvents...) {
+		events, err := brevo.GetEvents(eventType, days)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			i, ok := indexByEmail[strings.ToLower(event.Email)]
+			if !ok {
+				continue
+			}
+			member, ok := changed[i]
+			if !ok {
+				member = states.Current(members[i])
+			}
+
+			// The billing contact opting out only stops the emails to that address
+			if slices.Contains(optOutEvents, eventType) && !strings.EqualFold(event.Email, member.BillingEmail) {
+				if !member.EmailOptOut {
+					logger.Info("Member opted out of emails", "member", member.Email, "event", eventType, "date", event.Date.Format("2006-01-02"))
+					member.EmailOptOut = true
+					changed[i] = member
+				}
+				continue
+			}
+
+			if !isUndeliverable(member, event.Email) {
+				logger.Info("Member address is undeliverable", "member", member.Email, "address", event.Email, "event", eventType, "reason", event.Reason)
+				member.UndeliverableEmails = append(slices.Clone(member.UndeliverableEmails), event.Email)
+				changed[i] = member
+			}
+		}
+	}
+
+	for _, i := range slices.Sorted(maps.Keys(changed)) {
+		states.Update("brevo events", changed[i], helloasso.Payment{}, logger)
+	}
+
+	logger.Info("Finished ingesting Brevo email events", "updatedMembers", len(changed))
+	return nil
+}
+
+// memberEmails returns the primary and alternative addresses of the member
+func memberEmails(member baserow.Member) []string {
+	var emails []string
+	for _, email := range []string{member.Email, member.AlternativeEmail1, member.AlternativeEmail2} {
+		if email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// isUndeliverable reports whether Brevo reported the member address as
+// undeliverable
+func isUndeliverable(member baserow.Member, email string) bool {
+	return slices.ContainsFunc(member.UndeliverableEmails, func(undeliverable string) bool {
+		return strings.EqualFold(undeliverable, email)
+	})
+}
+
+// memberAddress returns the address to email the member at: the primary
+// address, or the first deliverable alternative address. It is empty when
+// the member opted out or has no deliverable address.
+func memberAddress(member baserow.Member) string {
+	if member.EmailOptOut {
+		return ""
+	}
+	for _, email := range memberEmails(member) {
+		if !isUndeliverable(member, email) {
+			return email
+		}
+	}
+	return ""
+}
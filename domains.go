@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// defaultEmailProviders is the built-in list of free/public email providers,
+// see data/email_providers.txt for the file format.
+//
+//go:embed data/email_providers.txt
+var defaultEmailProviders string
+
+// DomainRules decides for which email domains domain-based matching may be
+// used. It is built from the embedded provider list merged with an optional
+// user-supplied file (EMAIL_PROVIDERS_FILE).
+type DomainRules struct {
+	providers []string
+	allow     []string
+	deny      []string
+}
+
+// loadDomainRules parses the embedded provider list and, if file is not empty,
+// merges the rules found in that file.
+func loadDomainRules(file string) (*DomainRules, error) {
+	rules := &DomainRules{}
+	if err := rules.parse(strings.NewReader(defaultEmailProviders)); err != nil {
+		return nil, fmt.Errorf("invalid embedded email provider list: %w", err)
+	}
+
+	if file == "" {
+		return rules, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := rules.parse(f); err != nil {
+		return nil, fmt.Errorf("invalid email provider file %s: %w", file, err)
+	}
+	return rules, nil
+}
+
+// parse reads one rule per line: a domain or wildcard pattern, optionally
+// prefixed with "allow:" or "deny:". Blank lines and "#" comments are ignored.
+func (r *DomainRules) parse(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line == "" {
+			continue
+		}
+
+		target := &r.providers
+		if rule, ok := strings.CutPrefix(line, "allow:"); ok {
+			target, line = &r.allow, strings.TrimSpace(rule)
+		} else if rule, ok := strings.CutPrefix(line, "deny:"); ok {
+			target, line = &r.deny, strings.TrimSpace(rule)
+		}
+
+		if _, err := path.Match(line, ""); err != nil || line == "" {
+			return fmt.Errorf("line %d: invalid domain pattern %q", lineNumber, scanner.Text())
+		}
+		*target = append(*target, line)
+	}
+	return scanner.Err()
+}
+
+// AllowsDomainMatching reports whether payments from the domain may be matched
+// to members of the same domain. Explicit allow rules win over deny rules,
+// which win over the free/public provider rules.
+func (r *DomainRules) AllowsDomainMatching(domain string) bool {
+	if domain == "" {
+		return false
+	}
+	if matchesAnyDomain(r.allow, domain) {
+		return true
+	}
+	if matchesAnyDomain(r.deny, domain) {
+		return false
+	}
+	return !matchesAnyDomain(r.providers, domain)
+}
+
+// matchesAnyDomain reports whether the domain matches one of the patterns.
+// Patterns are exact domains or shell-like wildcards such as "*.mail.example".
+// A trailing ".*" only stands for a top-level domain, see matchesDomain.
+func matchesAnyDomain(patterns []string, domain string) bool {
+	for _, pattern := range patterns {
+		if matchesDomain(pattern, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesDomain reports whether the domain matches the pattern. "yahoo.*"
+// matches yahoo.com or yahoo.co.uk but not yahoo.acme.org: the trailing "*"
+// matches one label, or a short label followed by a country code.
+func matchesDomain(pattern, domain string) bool {
+	base, ok := strings.CutSuffix(pattern, ".*")
+	if !ok {
+		matched, _ := path.Match(pattern, domain)
+		return pattern == domain || matched
+	}
+
+	labels := strings.Split(domain, ".")
+	for n := 1; n <= 2 && n < len(labels); n++ {
+		suffix := labels[len(labels)-n:]
+		if n == 2 && (len(suffix[0]) > 3 || len(suffix[1]) != 2) {
+			continue
+		}
+		if matchesDomain(base, strings.Join(labels[:len(labels)-n], ".")) {
+			return true
+		}
+	}
+	return false
+}
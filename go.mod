@@ -4,4 +4,4 @@ go 1.24.4
 
 require github.com/samber/lo v1.51.0
 
-require golang.org/x/text v0.22.0 // indirect
+require golang.org/x/text v0.22.0
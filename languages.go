@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/boavizta/helloasso-renew-contribution/services/helloasso"
+)
+
+// defaultLanguages is the built-in language configuration, see
+// data/languages.txt for the file format.
+//
+//go:embed data/languages.txt
+var defaultLanguages string
+
+// Locale is a language members can be written to in
+type Locale struct {
+	Code string
+	// OptionId is the Baserow "Preferred Languages" option of the language
+	OptionId int
+	// FormUrl is the HelloAsso membership form used as renewal link
+	FormUrl string
+}
+
+// LanguageResolver picks the language of each member. It is built from the
+// embedded configuration merged with an optional user-supplied file
+// (LANGUAGES_FILE).
+type LanguageResolver struct {
+	Default   string
+	locales   map[string]Locale
+	options   map[int]string
+	countries map[string]string
+}
+
+// loadLanguageResolver parses the embedded language configuration and, if
+// file is not empty, merges the rules found in that file.
+func loadLanguageResolver(file string) (*LanguageResolver, error) {
+	resolver := &LanguageResolver{
+		locales:   map[string]Locale{},
+		options:   map[int]string{},
+		countries: map[string]string{},
+	}
+	if err := resolver.parse(strings.NewReader(defaultLanguages)); err != nil {
+		return nil, fmt.Errorf("invalid embedded language configuration: %w", err)
+	}
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		if err := resolver.parse(f); err != nil {
+			return nil, fmt.Errorf("invalid language file %s: %w", file, err)
+		}
+	}
+
+	if _, ok := resolver.locales[resolver.Default]; !ok {
+		return nil, fmt.Errorf("default language %q is not configured", resolver.Default)
+	}
+	for country, lang := range resolver.countries {
+		if _, ok := resolver.locales[lang]; !ok {
+			return nil, fmt.Errorf("country %q uses unconfigured language %q", country, lang)
+		}
+	}
+	return resolver, nil
+}
+
+// parse reads one rule per line: "language <code> <option id> <form url>",
+// "default <code>" or "<code>: <country>, <country>...". Blank lines and "#"
+// comments are ignored.
+func (r *LanguageResolver) parse(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "language":
+			if len(fields) != 4 {
+				return fmt.Errorf("line %d: expected language <code> <option id> <form url>", lineNumber)
+			}
+			optionId, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return fmt.Errorf("line %d: invalid Baserow option ID %q", lineNumber, fields[2])
+			}
+			code := strings.ToLower(fields[1])
+			r.locales[code] = Locale{Code: code, OptionId: optionId, FormUrl: fields[3]}
+			r.options[optionId] = code
+
+		case fields[0] == "default":
+			if len(fields) != 2 {
+				return fmt.Errorf("line %d: expected default <code>", lineNumber)
+			}
+			r.Default = strings.ToLower(fields[1])
+
+		default:
+			code, countries, found := strings.Cut(line, ":")
+			code = strings.ToLower(strings.TrimSpace(code))
+			if !found || code == "" || strings.ContainsAny(code, " \t") {
+				return fmt.Errorf("line %d: invalid rule %q", lineNumber, scanner.Text())
+			}
+			for _, country := range strings.Split(countries, ",") {
+				if country = normalizeCountry(country); country != "" {
+					r.countries[country] = code
+				}
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// normalizeCountry makes country lookups case insensitive
+func normalizeCountry(country string) string {
+	return strings.ToLower(strings.TrimSpace(country))
+}
+
+// Resolve returns the language of the member: the first configured preferred
+// language, else the language of the member's country, else the language of
+// the payer's country, else the default language. payment may be empty.
+func (r *LanguageResolver) Resolve(member baserow.Member, payment helloasso.Payment) string {
+	for _, optionId := range member.PreferredLanguages {
+		if lang, ok := r.options[optionId]; ok {
+			return lang
+		}
+	}
+	if lang, ok := r.countries[normalizeCountry(member.Country)]; ok {
+		return lang
+	}
+	if lang, ok := r.countries[normalizeCountry(payment.PayerCountry)]; ok {
+		return lang
+	}
+	return r.Default
+}
+
+// FormUrl returns the HelloAsso membership form of the language, or of the
+// default language when the language is not configured
+func (r *LanguageResolver) FormUrl(lang string) string {
+	if locale, ok := r.locales[lang]; ok {
+		return locale.FormUrl
+	}
+	return r.locales[r.Default].FormUrl
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/brevo"
+)
+
+// Mailer delivers the emails built by the Notifier
+type Mailer interface {
+	Send(email brevo.EmailData) error
+}
+
+// BatchMailer is a Mailer able to send many emails at once. It returns one
+// error per email, nil when the email was accepted.
+type BatchMailer interface {
+	Mailer
+	SendBatch(emails []brevo.EmailData) []error
+}
+
+// ScheduledMailer is a Mailer able to deliver an email later (ScheduledAt),
+// up to ScheduleHorizon ahead
+type ScheduledMailer interface {
+	Mailer
+	ScheduleHorizon() time.Duration
+}
+
+// SinkMailer is a Mailer for tests and dry runs: its emails don't reach the
+// members, so a run with it writes nothing to Baserow and uses no quota
+type SinkMailer interface {
+	Mailer
+	Sink()
+}
+
+// loadMailer returns the mailer selected by MAILER: "brevo" (default),
+// "smtp" (SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD) or "file"
+// (Maildir in MAILER_DIR)
+func loadMailer() (Mailer, error) {
+	switch os.Getenv("MAILER") {
+	case "", "brevo":
+		return brevoMailer{}, nil
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST environment variable must be set for the smtp mailer")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "25"
+		}
+		return smtpMailer{
+			addr:     net.JoinHostPort(host, port),
+			host:     host,
+			username: os.Getenv("SMTP_USERNAME"),
+			password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	case "file":
+		dir := os.Getenv("MAILER_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("MAILER_DIR environment variable must be set for the file mailer")
+		}
+		for _, sub := range []string{"tmp", "new", "cur"} {
+			if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+				return nil, err
+			}
+		}
+		return fileMailer{dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("invalid MAILER %q, expected brevo, smtp or file", os.Getenv("MAILER"))
+	}
+}
+
+// brevoMailer sends emails with the Brevo transactional API
+type brevoMailer struct{}
+
+func (brevoMailer) Send(email brevo.EmailData) error {
+	return brevo.SendEmail(email)
+}
+
+func (brevoMailer) SendBatch(emails []brevo.EmailData) []error {
+	return brevo.SendBatch(emails)
+}
+
+func (brevoMailer) ScheduleHorizon() time.Duration {
+	return 72 * time.Hour
+}
+
+// smtpMailer sends emails to an SMTP server, e.g. a local MailHog
+type smtpMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+}
+
+func (smtpMailer) Sink() {}
+
+func (m smtpMailer) Send(email brevo.EmailData) error {
+	if email.TemplateId != 0 {
+		return fmt.Errorf("brevo template %d can only be sent with the brevo mailer", email.TemplateId)
+	}
+
+	message, err := mimeMessage(email)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	recipients := append([]string{email.ToEmail}, email.Cc...)
+	if err := smtp.SendMail(m.addr, auth, email.SenderEmail, recipients, message); err != nil {
+		return fmt.Errorf("failed to send email to %s with SMTP: %w", email.ToEmail, err)
+	}
+	return nil
+}
+
+// fileMailer writes emails to a Maildir instead of sending them, for tests
+// and dry runs. Brevo template emails are written with their params as body.
+type fileMailer struct {
+	dir string
+}
+
+func (fileMailer) Sink() {}
+
+func (m fileMailer) Send(email brevo.EmailData) error {
+	if email.TemplateId != 0 {
+		params, err := json.MarshalIndent(email.Params, "", "  ")
+		if err != nil {
+			return err
+		}
+		if email.Headers == nil {
+			email.Headers = map[string]string{}
+		}
+		email.Headers["X-Brevo-Template-Id"] = fmt.Sprint(email.TemplateId)
+		email.TextContent = string(params)
+	}
+
+	message, err := mimeMessage(email)
+	if err != nil {
+		return err
+	}
+
+	// Maildir delivery: write in tmp then move to new
+	name := fmt.Sprintf("%d.%s.helloasso-renew", time.Now().UnixNano(), randomHex(8))
+	tmp := filepath.Join(m.dir, "tmp", name)
+	if err := os.WriteFile(tmp, message, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(m.dir, "new", name))
+}
+
+// mimeMessage builds a multipart/alternative message with the text and HTML
+// content of the email
+func mimeMessage(email brevo.EmailData) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	contents := []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", email.TextContent},
+		{"text/html; charset=utf-8", email.HtmlContent},
+	}
+	for _, c := range contents {
+		if c.content == "" {
+			continue
+		}
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {c.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writer := quotedprintable.NewWriter(part)
+		if _, err := writer.Write([]byte(c.content)); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	from := mail.Address{Name: email.SenderName, Address: email.SenderEmail}
+	to := mail.Address{Name: email.ToName, Address: email.ToEmail}
+	headers := []string{
+		"From: " + from.String(),
+		"To: " + to.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", email.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		fmt.Sprintf("Message-ID: <%s@%s>", randomHex(16), domainOf(email.SenderEmail)),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + parts.Boundary(),
+	}
+	if len(email.Cc) > 0 {
+		headers = append(headers, "Cc: "+strings.Join(email.Cc, ", "))
+	}
+	if email.ReplyToEmail != "" {
+		replyTo := mail.Address{Name: email.ReplyToName, Address: email.ReplyToEmail}
+		headers = append(headers, "Reply-To: "+replyTo.String())
+	}
+	if len(email.Tags) > 0 {
+		headers = append(headers, "X-Tags: "+strings.Join(email.Tags, ", "))
+	}
+	custom := make([]string, 0, len(email.Headers))
+	for name, value := range email.Headers {
+		custom = append(custom, name+": "+value)
+	}
+	sort.Strings(custom)
+	headers = append(headers, custom...)
+
+	var message bytes.Buffer
+	message.WriteString(strings.Join(headers, "\r\n"))
+	message.WriteString("\r\n\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// domainOf returns the domain of an address, for the Message-ID
+func domainOf(address string) string {
+	if _, domain, found := strings.Cut(address, "@"); found {
+		return domain
+	}
+	return "localhost"
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,15 +1,16 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"strings"
 	"time"
 	"unicode"
 
 	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
-	"github.com/boavizta/helloasso-renew-contribution/services/brevo"
 	"github.com/boavizta/helloasso-renew-contribution/services/helloasso"
 	"github.com/samber/lo"
 )
@@ -45,95 +46,13 @@ func extractDomain(email string) string {
 	return strings.ToLower(parts[1])
 }
 
-// commonEmailProviders lists free/public email domains for which domain-based
-// matching must NOT be used (anyone can register, the domain says nothing about
-// organisational affiliation). Payments from these domains fall through to the
-// standard email-based matching.
-var commonEmailProviders = map[string]bool{
-	// International
-	"gmail.com":          true,
-	"hotmail.com":        true,
-	"hotmail.co.uk":      true,
-	"outlook.com":        true,
-	"outlook.fr":         true,
-	"live.com":           true,
-	"live.fr":            true,
-	"msn.com":            true,
-	"yahoo.com":          true,
-	"yahoo.fr":           true,
-	"yahoo.co.uk":        true,
-	"aol.com":            true,
-	"icloud.com":         true,
-	"me.com":             true,
-	"mac.com":            true,
-	"protonmail.com":     true,
-	"proton.me":          true,
-	"tutanota.com":       true,
-	"tuta.io":            true,
-	"gmx.com":            true,
-	"gmx.fr":             true,
-	"mail.com":           true,
-	"yandex.com":         true,
-	"zoho.com":           true,
-	"fastmail.com":       true,
-	"hushmail.com":       true,
-	"startmail.com":      true,
-	// French ISPs
-	"laposte.net":        true,
-	"orange.fr":          true,
-	"wanadoo.fr":         true,
-	"free.fr":            true,
-	"sfr.fr":             true,
-	"numericable.fr":     true,
-	"bbox.fr":            true,
-	"neuf.fr":            true,
-	// Alumni / school
-	"gadz.org":           true,
-	"m4x.org":            true,
-	// Disposable / temporary email providers
-	"mailinator.com":     true,
-	"guerrillamail.com":  true,
-	"10minutemail.com":   true,
-	"tempmail.com":       true,
-	"temp-mail.org":      true,
-	"throwawaymail.com":  true,
-	"yopmail.com":        true,
-	"getnada.com":        true,
-	"nada.email":         true,
-	"fakeinbox.com":      true,
-	"sharklasers.com":    true,
-	"trashmail.com":      true,
-	"trashmail.net":      true,
-	"mintemail.com":      true,
-	"mohmal.com":         true,
-	"tempinbox.com":      true,
-	"maildrop.cc":        true,
-	"mailnesia.com":      true,
-	"spamgourmet.com":    true,
-	"dispostable.com":    true,
-	"mailcatch.com":      true,
-	"tempmailo.com":      true,
-	"emailondeck.com":    true,
-	"mytemp.email":       true,
-	"burnermail.io":      true,
-	"isposable.com":      true,
-	"moakt.com":          true,
-	"tmpmail.org":        true,
-	"tmpmail.net":        true,
-}
-
-// isCommonEmailProvider reports whether the domain is a free/public email provider
-// for which domain-based matching is not meaningful.
-func isCommonEmailProvider(domain string) bool {
-	return commonEmailProviders[domain]
-}
-
 const IndividualTypeId = 2521
 const OrganizationTypeId = 2520
 
-const EnglishId = 2590
-const FrenchId = 2591
-const SpanishId = 2592
+// sameDay reports whether both times are on the same calendar date, as stored in Baserow
+func sameDay(t1, t2 time.Time) bool {
+	return t1.Format("2006-01-02") == t2.Format("2006-01-02")
+}
 
 // MemberPaymentPair merges a member with their payment for processing
 type MemberPaymentPair struct {
@@ -142,36 +61,130 @@ type MemberPaymentPair struct {
 }
 
 func main() {
+	// Subcommands (preview, test-send...) replace the reconciliation
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+		os.Exit(runCommand(os.Args[1], os.Args[2:], slog.Default()))
+	}
+
+	paymentsFile := flag.String("payments-file", "", "HelloAsso payments or items export (.csv or .xlsx) to use instead of the HelloAsso API")
+	force := flag.Bool("force", false, "send the planned emails and apply the deactivations even above EMAIL_SANITY_THRESHOLD and MAX_DEACTIVATION_PERCENT")
+	flag.Parse()
+
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
 
-	logger.Info("Starting HelloAsso payment fetcher")
+	audit := loadAuditLog(time.Now())
+	logger.Info("Starting HelloAsso payment fetcher", "run", audit.RunId)
+
+	domainRules, err := loadDomainRules(os.Getenv("EMAIL_PROVIDERS_FILE"))
+	if err != nil {
+		logger.Error("Error loading email provider rules", "error", err)
+		os.Exit(1)
+	}
+
+	notifier, err := loadNotifier()
+	if err != nil {
+		logger.Error("Error loading email configuration", "error", err)
+		os.Exit(1)
+	}
+	notifier.Audit = audit
+
+	// The smtp and file mailers only capture the emails: recording them on
+	// the members would use up their reminders
+	_, dryRun := notifier.Mailer.(SinkMailer)
+	if dryRun {
+		logger.Warn("Dry run: Baserow, the Brevo members list, the email quota and the audit log are not written", "mailer", os.Getenv("MAILER"))
+	}
+
+	schedule, err := loadReminderSchedule(os.Getenv("REMINDER_SCHEDULE"), notifier)
+	if err != nil {
+		logger.Error("Error loading reminder schedule", "error", err)
+		os.Exit(1)
+	}
+
+	notifier.Recipients, err = loadRecipientPolicy(schedule)
+	if err != nil {
+		logger.Error("Error loading recipient policy", "error", err)
+		os.Exit(1)
+	}
+
+	notifier.Window, err = loadSendWindow()
+	if err != nil {
+		logger.Error("Error loading send window", "error", err)
+		os.Exit(1)
+	}
+
+	if !dryRun {
+		notifier.Quota, err = loadEmailQuota()
+		if err != nil {
+			logger.Error("Error loading email quota", "error", err)
+			os.Exit(1)
+		}
+	}
+	sanityThreshold, err := quotaValue("EMAIL_SANITY_THRESHOLD")
+	if err != nil {
+		logger.Error("Error loading email sanity threshold", "error", err)
+		os.Exit(1)
+	}
+
+	preExpiryOffsets, err := loadPreExpiryOffsets(os.Getenv("PRE_EXPIRY_REMINDER_DAYS"))
+	if err != nil {
+		logger.Error("Error loading pre-expiry reminder days", "error", err)
+		os.Exit(1)
+	}
+
+	thankYouMaxAge, err := loadThankYouMaxAge()
+	if err != nil {
+		logger.Error("Error loading thank-you email configuration", "error", err)
+		os.Exit(1)
+	}
+
+	welcomeFollowUpDelay, err := loadWelcomeFollowUpDelay()
+	if err != nil {
+		logger.Error("Error loading welcome email configuration", "error", err)
+		os.Exit(1)
+	}
 
-	payments, err := helloasso.GetPayments()
+	brevoEventsDays, err := loadBrevoEventsDays()
 	if err != nil {
-		logger.Error("Error fetching payments", "error", err)
+		logger.Error("Error loading Brevo events configuration", "error", err)
 		os.Exit(1)
 	}
 
-	logger.Info("Successfully fetched payments", "count", len(payments))
+	membersListId, err := loadMembersListId()
+	if err != nil {
+		logger.Error("Error loading Brevo members list configuration", "error", err)
+		os.Exit(1)
+	}
 
-	freeMemberships, err := helloasso.GetFreeMembershipItems()
+	maxDeactivationPercent, err := loadMaxDeactivationPercent()
 	if err != nil {
-		logger.Error("Error fetching free membership items", "error", err)
+		logger.Error("Error loading deactivation threshold", "error", err)
 		os.Exit(1)
 	}
 
-	logger.Info("Successfully fetched free membership items", "count", len(freeMemberships))
+	// Merge payments of all configured sources (HelloAsso, bank transfers...)
+	var payments []helloasso.Payment
+	for _, source := range configuredPaymentSources(*paymentsFile) {
+		sourcePayments, err := source.GetPayments()
+		if err != nil {
+			logger.Error("Error fetching payments", "source", source.Name(), "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Successfully fetched payments", "source", source.Name(), "count", len(sourcePayments))
+		payments = append(payments, sourcePayments...)
+	}
 
-	payments = append(payments, freeMemberships...)
-	logger.Info("Total contributions after merging free memberships", "count", len(payments))
+	logger.Info("Total contributions after merging payment sources", "count", len(payments))
 
-	// Filter payments to keep only those with form slugs "cotisation-annuelle" or "annual-membership-fee"
+	// Filter payments to keep only annual membership forms ("cotisation-annuelle",
+	// "annual-membership-fee") and offline membership payments
 	filteredPayments := lo.Filter(payments, func(payment helloasso.Payment, _ int) bool {
-		return payment.OrderFormSlug == "cotisation-annuelle" || payment.OrderFormSlug == "annual-membership-fee"
+		return membershipFormSlugs[payment.OrderFormSlug]
 	})
 
-	logger.Info("Filtered payments with form slugs 'cotisation-annuelle' or 'annual-membership-fee'", "count", len(filteredPayments))
+	logger.Info("Filtered membership payments", "count", len(filteredPayments))
 
 	// Group payments by email and keep only the most recent one for each email
 	uniquePayments := lo.Values(
@@ -198,6 +211,26 @@ func main() {
 	}
 	logger.Info("Successfully fetched members from Baserow", "count", len(members))
 
+	// Every phase works on the same member states, written once at the end
+	states := newMemberStates(members)
+
+	// Record bounces and unsubscribes before deciding who to email
+	if brevoEventsDays > 0 {
+		if err := ingestDeliveryEvents(members, brevoEventsDays, states, logger); err != nil {
+			logger.Error("Error ingesting Brevo email events", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Fetch exceptional memberships that must not follow the automatic rules
+	overrides, err := baserow.GetOverrides()
+	if err != nil {
+		logger.Error("Error fetching membership overrides from Baserow", "error", err)
+		os.Exit(1)
+	}
+	report := &RunReport{Overrides: newMemberOverrides(overrides, time.Now())}
+	logger.Info("Active membership overrides", "count", len(report.Overrides))
+
 	// Create a map of members by email for easier lookup
 	// Include primary email and alternative emails if they exist
 	membersByEmail := lo.Reduce(members, func(acc map[string]baserow.Member, member baserow.Member, _ int) map[string]baserow.Member {
@@ -231,6 +264,8 @@ func main() {
 
 	// Track which members were updated via domain matching to skip them in email phase
 	domainUpdatedIds := map[int]bool{}
+	// Members activated for the first time (no previous payment), for welcome emails
+	var firstActivations []MemberPaymentPair
 
 	lo.ForEach(paymentsByDomain, func(payment helloasso.Payment, _ int) {
 		domain := extractDomain(payment.PayerEmail)
@@ -240,7 +275,7 @@ func main() {
 
 		// Skip common/free email providers — domain matching is not meaningful
 		// for them, these payments fall through to the email-based matching.
-		if isCommonEmailProvider(domain) {
+		if !domainRules.AllowsDomainMatching(domain) {
 			logger.Info("Skipping domain matching for common email provider",
 				"domain", domain,
 				"payer", payment.PayerEmail,
@@ -265,7 +300,7 @@ func main() {
 			return
 		}
 
-		domainMembers := lo.Filter(members, func(member baserow.Member, _ int) bool {
+		domainMembers := lo.Filter(states.Members(), func(member baserow.Member, _ int) bool {
 			return extractDomain(member.Email) == domain ||
 				(member.AlternativeEmail1 != "" && extractDomain(member.AlternativeEmail1) == domain) ||
 				(member.AlternativeEmail2 != "" && extractDomain(member.AlternativeEmail2) == domain)
@@ -288,18 +323,15 @@ func main() {
 		)
 
 		lo.ForEach(inactiveMembers, func(member baserow.Member, _ int) {
+			firstActivation := member.LastPaymentDate.IsZero()
 			member.ActiveMembership = true
 			member.LastPaymentDate = payment.OrderDate
 			member.NumberContributionsEmail = 0
 
-			if updateErr := baserow.UpdateMember(member); updateErr != nil {
-				logger.Error("Error updating member in Baserow",
-					"error", updateErr,
-					"member", member.Email,
-					"domain", domain,
-				)
-			} else {
-				domainUpdatedIds[member.Id] = true
+			states.Update("domain matching", member, payment, logger)
+			domainUpdatedIds[member.Id] = true
+			if firstActivation {
+				firstActivations = append(firstActivations, MemberPaymentPair{Member: member, Payment: payment})
 			}
 		})
 	})
@@ -343,26 +375,76 @@ func main() {
 			threshold = thirteenMonthsAgo
 		}
 		return !pair.Payment.OrderDate.Before(threshold) &&
-			(pair.Member.ActiveMembership == false || pair.Member.LastPaymentDate.Format("2006-01-02") != pair.Payment.OrderDate.Format("2006-01-02"))
+			(pair.Member.ActiveMembership == false || !sameDay(pair.Member.LastPaymentDate, pair.Payment.OrderDate))
 	})
 
 	logger.Info("Members with payment needed", "count", len(membersToUpdatePaymentNeeded))
 
+	// Plan every email of the run first so they are counted and sent in
+	// batches, each member is written depending on whether its email was accepted
+	renewalOutbox := newOutbox("renewal", notifier, states)
+	reminderSlot := newSendSlot(notifier, time.Now())
+	if reminderSlot.deferred {
+		logger.Info("Outside of the send window, renewal reminders are deferred to a later run")
+	} else if reminderSlot.at.After(time.Now()) {
+		logger.Info("Outside of the send window, renewal reminders are scheduled", "at", reminderSlot.at)
+	}
 	lo.ForEach(membersToUpdatePaymentNeeded, func(pair MemberPaymentPair, _ int) {
-		sendEmailAndUpdate(pair, logger)
+		pair.Member = states.Current(pair.Member)
+		planRenewalReminder(pair, schedule, reminderSlot, states, renewalOutbox, report, logger)
 	})
 
-	logger.Info("Finished updating members with payment needed in Baserow")
-
 	logger.Info("Members status to update", "count", len(membersToUpdateStatusUpdate))
 	logger.Info("Updating all members status in Baserow")
 
 	lo.ForEach(membersToUpdateStatusUpdate, func(pair MemberPaymentPair, _ int) {
-		updateValidMembers(pair, err, logger)
+		pair.Member = states.Current(pair.Member)
+		updateValidMembers(pair, states, logger)
+		if pair.Member.LastPaymentDate.IsZero() {
+			firstActivations = append(firstActivations, pair)
+		}
 	})
 
 	logger.Info("Finished updating members status in Baserow")
 
+	// --- Pre-expiry reminders for active members whose membership ends soon ---
+	preExpiryOutbox := newOutbox("pre-expiry", notifier, states)
+	if len(preExpiryOffsets) > 0 {
+		planPreExpiryReminders(membersWithPayment, preExpiryOffsets, notifier, states, preExpiryOutbox, report, logger)
+	}
+
+	// --- Welcome emails for first-time members ---
+	welcomeOutbox := newOutbox("welcome", notifier, states)
+	involvedOutbox := newOutbox("get involved", notifier, states)
+	welcomed := map[int]bool{}
+	if welcomeFollowUpDelay > 0 {
+		welcomed = planWelcomeEmails(firstActivations, welcomeFollowUpDelay, states, welcomeOutbox, involvedOutbox, report, logger)
+	}
+
+	// --- Thank-you emails for newly detected payments ---
+	thankYouOutbox := newOutbox("thank-you", notifier, states)
+	if thankYouMaxAge > 0 {
+		planThankYouEmails(membersWithPayment, thankYouMaxAge, welcomed, states, thankYouOutbox, report, logger)
+	}
+
+	// Renewal reminders first, so they get the quota before the other emails
+	outboxes := []*Outbox{renewalOutbox, preExpiryOutbox, welcomeOutbox, involvedOutbox, thankYouOutbox}
+
+	// A misconfiguration could email every member at once
+	planned := lo.SumBy(outboxes, func(outbox *Outbox) int {
+		return outbox.Planned()
+	})
+	if sanityThreshold > 0 && planned > sanityThreshold && !*force {
+		logger.Error("Planned emails exceed EMAIL_SANITY_THRESHOLD, aborting before sending anything. Check the configuration, or run with --force",
+			"planned", planned, "threshold", sanityThreshold)
+		os.Exit(1)
+	}
+	for _, outbox := range outboxes {
+		result := outbox.Send(logger)
+		logger.Info("Finished sending emails", "phase", outbox.phase,
+			"sent", result.Sent, "failed", result.Failed, "overQuota", result.OverQuota)
+	}
+
 	// --- Deactivate members with no recent payment (within 13 months) ---
 
 	// Collect all member IDs that were already processed in earlier steps
@@ -384,18 +466,22 @@ func main() {
 		recentPaymentEmails[payment.PayerEmail] = true
 
 		domain := extractDomain(payment.PayerEmail)
-		if domain != "" && !isCommonEmailProvider(domain) {
+		if domainRules.AllowsDomainMatching(domain) {
 			recentPaymentDomains[domain] = true
 		}
 	}
 
-	membersToDeactivate := lo.Filter(members, func(member baserow.Member, _ int) bool {
+	membersToDeactivate := lo.Filter(states.Members(), func(member baserow.Member, _ int) bool {
 		if processedMemberIds[member.Id] {
 			return false
 		}
 		if !member.ActiveMembership {
 			return false
 		}
+		if report.Overrides.NeverDeactivate(member.Id) {
+			report.addOverrideDecision(member, "kept active despite no recent payment")
+			return false
+		}
 
 		// Check if member has a recent payment by email
 		if recentPaymentEmails[member.Email] ||
@@ -418,34 +504,20 @@ func main() {
 		return true
 	})
 
-	logger.Info("Members to deactivate (no recent payment in 13 months)", "count", len(membersToDeactivate))
-
-	lo.ForEach(membersToDeactivate, func(member baserow.Member, _ int) {
-		member.ActiveMembership = false
-
-		if updateErr := baserow.UpdateMember(member); updateErr != nil {
-			logger.Error("Error deactivating member in Baserow",
-				"error", updateErr,
-				"member", member.Email,
-			)
-		} else {
-			logger.Info("Deactivated member (no recent payment)",
-				"member", member.Email,
-				"id", member.Id,
-			)
-		}
-	})
-
-	logger.Info("Finished deactivating members with no recent payment")
-
 	// --- Safety net: deactivate ANY active member whose LastPaymentDate is
 	// older than 13 months, or has no LastPaymentDate at all ---
 	// Runs after all other steps. Members with a recent HelloAsso entry
 	// already have their LastPaymentDate updated, so they won't match. This
 	// catches members activated by domain-matching with an old payment,
 	// members with stale data, and members with no payment date recorded.
-	staleMembers := lo.Filter(members, func(member baserow.Member, _ int) bool {
-		if !member.ActiveMembership {
+	deactivatedIds := lo.SliceToMap(membersToDeactivate, func(member baserow.Member) (int, bool) {
+		return member.Id, true
+	})
+	staleMembers := lo.Filter(states.Members(), func(member baserow.Member, _ int) bool {
+		if !member.ActiveMembership || deactivatedIds[member.Id] {
+			return false
+		}
+		if report.Overrides.NeverDeactivate(member.Id) {
 			return false
 		}
 		// No payment date at all → stale
@@ -455,47 +527,93 @@ func main() {
 		return member.LastPaymentDate.Before(thirteenMonthsAgo)
 	})
 
+	logger.Info("Members to deactivate (no recent payment in 13 months)", "count", len(membersToDeactivate))
 	logger.Info("Stale members to deactivate (LastPaymentDate > 13 months or missing)", "count", len(staleMembers))
 
+	// A truncated payment source would deactivate most members at once
+	plannedDeactivations := append(slices.Clone(membersToDeactivate), staleMembers...)
+	if reason := checkDeactivations(plannedDeactivations, members, maxDeactivationPercent); reason != "" {
+		if *force {
+			logger.Warn("Applying deactivations above the threshold (--force)", "reason", reason)
+		} else {
+			logger.Error("Refusing to deactivate members, check the payment sources or run with --force", "reason", reason)
+			report.RefusedDeactivations = plannedDeactivations
+			report.RefusedDeactivationsReason = reason
+			membersToDeactivate, staleMembers = nil, nil
+		}
+	}
+
+	lo.ForEach(membersToDeactivate, func(member baserow.Member, _ int) {
+		member.ActiveMembership = false
+		states.Update("deactivation", member, helloasso.Payment{}, logger)
+		logger.Info("Deactivating member (no recent payment)",
+			"member", member.Email,
+			"id", member.Id,
+		)
+	})
+
+	logger.Info("Finished deactivating members with no recent payment")
+
 	lo.ForEach(staleMembers, func(member baserow.Member, _ int) {
 		member.ActiveMembership = false
+		states.Update("stale safety net", member, helloasso.Payment{}, logger)
 
-		if updateErr := baserow.UpdateMember(member); updateErr != nil {
-			logger.Error("Error deactivating stale member in Baserow",
-				"error", updateErr,
-				"member", member.Email,
-			)
-		} else {
-			lastPayment := "none"
-			if !member.LastPaymentDate.IsZero() {
-				lastPayment = member.LastPaymentDate.Format("2006-01-02")
-			}
-			logger.Info("Deactivated stale member",
-				"member", member.Email,
-				"id", member.Id,
-				"lastPayment", lastPayment,
-			)
+		lastPayment := "none"
+		if !member.LastPaymentDate.IsZero() {
+			lastPayment = member.LastPaymentDate.Format("2006-01-02")
 		}
+		logger.Info("Deactivating stale member",
+			"member", member.Email,
+			"id", member.Id,
+			"lastPayment", lastPayment,
+		)
 	})
 
 	logger.Info("Finished deactivating stale members")
 
+	/// ### Baserow writes
+	if dryRun {
+		logger.Info("Dry run, members not written to Baserow")
+	} else {
+		report.Writes = states.Flush(audit, logger)
+		if err := audit.Flush(); err != nil {
+			logger.Error("Error recording the run in the audit log", "error", err)
+		}
+	}
+	report.Conflicts = states.Conflicts()
+
+	/// ### Brevo members list
+	if membersListId > 0 && !dryRun {
+		// Members are fetched again to mirror what was written
+		syncedMembers, err := baserow.GetMembers()
+		if err != nil {
+			logger.Error("Error fetching members from Baserow", "error", err)
+		} else if err := syncMembersList(membersListId, syncedMembers, paymentsByEmail, notifier.Languages, logger); err != nil {
+			logger.Error("Error syncing members to the Brevo list", "error", err)
+		}
+	}
+
 	/// ### Stats
 	generateStats(members, paymentsByEmail, logger, uniquePayments, membersByEmail)
+	report.Print(members, logger)
 }
 
-func updateValidMembers(pair MemberPaymentPair, err error, logger *slog.Logger) {
+func updateValidMembers(pair MemberPaymentPair, states *MemberStates, logger *slog.Logger) {
 	member := pair.Member
 	payment := pair.Payment
 
+	// A new payment starts a new membership period: pre-expiry reminders of
+	// the previous period no longer count
+	if !sameDay(member.LastPaymentDate, payment.OrderDate) {
+		member.NumberPreExpiryEmails = 0
+	}
+
 	member.ActiveMembership = true
 	member.LastPaymentDate = payment.OrderDate
 	member.NumberContributionsEmail = 0
 
-	err = baserow.UpdateMember(member)
-	if err != nil {
-		logger.Error("Error updating member in Baserow", "error", err, "member", member.Email)
-	}
+	logger.Debug("Updating member status", "member", member.Email)
+	states.Update("payment status", member, payment, logger)
 }
 
 func generateStats(members []baserow.Member, paymentsByEmail map[string]helloasso.Payment, logger *slog.Logger, uniquePayments []helloasso.Payment, membersByEmail map[string]baserow.Member) {
@@ -562,13 +680,24 @@ func generateStats(members []baserow.Member, paymentsByEmail map[string]helloass
 	}
 }
 
-func sendEmailAndUpdate(pair MemberPaymentPair, logger *slog.Logger) {
+// planRenewalReminder deactivates the member and queues the reminder due, if
+// any, in the outbox. The reminder is recorded on the member once sent.
+func planRenewalReminder(pair MemberPaymentPair, schedule ReminderSchedule, slot sendSlot, states *MemberStates, outbox *Outbox, report *RunReport, logger *slog.Logger) {
 	member := pair.Member
 	payment := pair.Payment
 
-	member.ActiveMembership = false
+	if report.Overrides.NeverDeactivate(member.Id) {
+		if member.ActiveMembership {
+			report.addOverrideDecision(member, "kept active despite expired payment")
+		}
+	} else {
+		member.ActiveMembership = false
+	}
 	member.LastPaymentDate = payment.OrderDate
 
+	// Always update the member (deactivation + payment date), even if no email is sent
+	states.Update("renewal", member, payment, logger)
+
 	// Free memberships: deactivate without sending renewal email.
 	// LastPaymentDate is set to the subscription date (payment.OrderDate) so
 	// the safety net and future runs can correctly assess staleness.
@@ -577,96 +706,37 @@ func sendEmailAndUpdate(pair MemberPaymentPair, logger *slog.Logger) {
 			"member", member.Email,
 			"subscriptionDate", payment.OrderDate.Format("2006-01-02"),
 		)
-		if err := baserow.UpdateMember(member); err != nil {
-			logger.Error("Error updating free member in Baserow", "error", err, "member", member.Email)
-		} else {
-			logger.Info("Deactivated free member (no email)",
-				"member", member.Email,
-				"lastPaymentDate", member.LastPaymentDate.Format("2006-01-02"),
-			)
-		}
+		logger.Info("Deactivating free member (no email)",
+			"member", member.Email,
+			"lastPaymentDate", member.LastPaymentDate.Format("2006-01-02"),
+		)
 		return
 	}
 
-	// Determine language preference
-	isFrench := false
-	for _, langId := range member.PreferredLanguages {
-		if langId == FrenchId {
-			isFrench = true
-			break
-		}
+	// Select the reminder of the campaign due for this member
+	stage, due, exhausted := schedule.NextStage(member, time.Now())
+	if exhausted {
+		report.ExhaustedReminders = append(report.ExhaustedReminders, member)
 	}
-	if !isFrench && member.Country == "France" {
-		isFrench = true
-	}
-
-	contributionLink := "https://www.helloasso.com/associations/boavizta/adhesions/annual-membership-fee"
-	if isFrench {
-		contributionLink = "https://www.helloasso.com/associations/boavizta/adhesions/cotisation-annuelle"
-	}
-
-	var subject, htmlContent, textContent string
 
-	if isFrench {
-		subject = "Prêt pour une nouvelle année avec Boavizta ? Il est temps de renouveler votre adhésion"
-		htmlContent = "<html><body>" +
-			"<p>Cher(e) " + toCamelCase(member.FirstName) + ",</p>" +
-			"<p>Alors que votre adhésion à Boavizta touche à sa fin, nous tenons à vous remercier d'avoir été avec nous cette année !</p>" +
-			"<p>Boavizta existe grâce aux incroyables contributions de ses membres, des personnes comme vous qui nous aident à créer et partager des communs pour promouvoir des pratiques numériques respectueuses des limites planétaires. Votre implication fait vraiment la différence.</p>" +
-			"<p>Nous sommes enthousiastes à l'idée de ce qui nous attend en 2026 et nous serons heureux de vous voir rester impliqué(e) dans notre communauté.</p>" +
-			"<p>👉 Pour renouveler votre adhésion, <a href=\"" + contributionLink + "\">cliquez simplement ici</a>.</p>" +
-			"<p>Merci encore de faire partie de Boavizta !</p>" +
-			"<p>Cordialement,<br>L'équipe Boavizta</p>" +
-			"</body></html>"
-		textContent = "Cher(e) " + toCamelCase(member.FirstName) + ",\n\n" +
-			"Alors que votre adhésion à Boavizta touche à sa fin, nous tenons à vous remercier d'avoir été avec nous cette année !\n\n" +
-			"Boavizta existe grâce aux incroyables contributions de ses membres, des personnes comme vous qui nous aident à créer et partager des communs pour promouvoir des pratiques numériques respectueuses des limites planétaires. Votre implication fait vraiment la différence.\n\n" +
-			"Nous sommes enthousiastes à l'idée de ce qui nous attend en 2026 et nous serons heureux de vous voir rester impliqué(e) dans notre communauté.\n\n" +
-			"👉 Pour renouveler votre adhésion, cliquez simplement ici : " + contributionLink + "\n\n" +
-			"Merci encore de faire partie de Boavizta !\n\n" +
-			"Cordialement,\nL'équipe Boavizta"
+	// Queue the reminder only if its stage is due, nothing once the schedule is exhausted
+	if exhausted || !due {
+		logger.Debug("No renewal reminder due", "member", member.Email, "sent", member.NumberContributionsEmail, "exhausted", exhausted)
+	} else if report.Overrides.NeverEmail(member.Id) {
+		report.addOverrideDecision(member, "renewal email not sent")
+	} else if memberAddress(member) == "" {
+		report.Undeliverable = append(report.Undeliverable, member)
+	} else if slot.deferred {
+		report.DeferredReminders = append(report.DeferredReminders, member)
 	} else {
-		subject = "Ready for another year with Boavizta? It's time to renew your membership"
-		htmlContent = "<html><body>" +
-			"<p>Dear " + toCamelCase(member.FirstName) + ",</p>" +
-			"<p>As your membership with Boavizta comes to an end, we want to say thank you for being with us this past year!</p>" +
-			"<p>Boavizta exists thanks to the incredible contributions of its members, people like you who help us create and share commons to promote digital practices that respect planetary boundaries. Your involvement really makes a difference.</p>" +
-			"<p>We're excited about what's coming in 2026 and we will be happy to see you stay involved in our community.</p>" +
-			"<p>👉 To renew your membership, simply <a href=\"" + contributionLink + "\">click here</a>.</p>" +
-			"<p>Thanks again for being part of Boavizta!</p>" +
-			"<p>Warm regards,<br>Boavizta Team</p>" +
-			"</body></html>"
-		textContent = "Dear " + toCamelCase(member.FirstName) + ",\n\n" +
-			"As your membership with Boavizta comes to an end, we want to say thank you for being with us this past year!\n\n" +
-			"Boavizta exists thanks to the incredible contributions of its members, people like you who help us create and share commons to promote digital practices that respect planetary boundaries. Your involvement really makes a difference.\n\n" +
-			"We're excited about what's coming in 2026 and we will be happy to see you stay involved in our community.\n\n" +
-			"👉 To renew your membership, simply click here: " + contributionLink + "\n\n" +
-			"Thanks again for being part of Boavizta!\n\n" +
-			"Warm regards,\nBoavizta Team"
-	}
-
-	emailData := brevo.EmailData{
-		SenderName:  "Boavizta",
-		SenderEmail: "no-reply@boavizta.org",
-		ToEmail:     member.Email,
-		ToName:      toCamelCase(member.FirstName) + " " + member.Surname,
-		Subject:     subject,
-		HtmlContent: htmlContent,
-		TextContent: textContent,
-	}
-
-	// Send renewal email only if last one was more than 14 days ago
-	if member.LastContributionEmailDate.Before(time.Now().AddDate(0, 0, -14)) {
-		if err := brevo.SendEmail(emailData); err != nil {
-			logger.Error("Error sending email notification", "error", err, "member", member.Email)
-		} else {
-			member.LastContributionEmailDate = time.Now()
-			member.NumberContributionsEmail++
+		data := TemplateData{Payment: payment, ExpiryDate: membershipExpiry(payment.OrderDate)}
+		err := outbox.Add(stage.Name, data, slot.at, member, func(sent *baserow.Member) {
+			// A reminder scheduled for later is recorded at its delivery date
+			sent.LastContributionEmailDate = slot.at
+			sent.NumberContributionsEmail++
+		})
+		if err != nil {
+			logger.Error("Error rendering email notification", "error", err, "member", member.Email)
 		}
 	}
-
-	// Always update Baserow (deactivation + payment date), even if email was rate-limited
-	if err := baserow.UpdateMember(member); err != nil {
-		logger.Error("Error updating member in Baserow", "error", err, "member", member.Email)
-	}
 }
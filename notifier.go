@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/boavizta/helloasso-renew-contribution/services/brevo"
+)
+
+// Notifier renders the email templates in the member's language and sends
+// them to members
+type Notifier struct {
+	Templates *EmailTemplates
+	Languages *LanguageResolver
+	// BrevoTemplates maps "<email>" or "<email>.<lang>" to the Brevo template
+	// sent instead of the local template, see loadBrevoTemplateIds
+	BrevoTemplates map[string]int
+	// ReplyTo is the reply-to address of the emails, the sender when empty
+	ReplyTo    string
+	Mailer     Mailer
+	Recipients RecipientPolicy
+	// Window restricts when reminders are sent, see newSendSlot
+	Window *SendWindow
+	Quota  *EmailQuota
+	// Audit records the sent emails, nil outside of a run
+	Audit *AuditLog
+}
+
+// loadNotifier loads the languages, the local templates, the Brevo template
+// IDs and the mailer (LANGUAGES_FILE, EMAIL_TEMPLATES_DIR, BREVO_TEMPLATE_IDS,
+// MAILER)
+func loadNotifier() (*Notifier, error) {
+	languages, err := loadLanguageResolver(os.Getenv("LANGUAGES_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load language configuration: %w", err)
+	}
+	templates, err := loadEmailTemplates(os.Getenv("EMAIL_TEMPLATES_DIR"), languages.Default)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load email templates: %w", err)
+	}
+	brevoTemplates, err := loadBrevoTemplateIds(os.Getenv("BREVO_TEMPLATE_IDS"))
+	if err != nil {
+		return nil, err
+	}
+	mailer, err := loadMailer()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Notifier{
+		Templates:      templates,
+		Languages:      languages,
+		BrevoTemplates: brevoTemplates,
+		ReplyTo:        os.Getenv("EMAIL_REPLY_TO"),
+		Mailer:         mailer,
+	}, nil
+}
+
+// loadBrevoTemplateIds parses a list such as "renewal:12,renewal.fr:13": the
+// Brevo template of an email in every language, or in one language
+func loadBrevoTemplateIds(value string) (map[string]int, error) {
+	ids := map[string]int{}
+	if strings.TrimSpace(value) == "" {
+		return ids, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		key, idValue, found := strings.Cut(strings.TrimSpace(item), ":")
+		if !found {
+			return nil, fmt.Errorf("invalid BREVO_TEMPLATE_IDS item %q, expected email:id or email.lang:id", item)
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(idValue))
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid BREVO_TEMPLATE_IDS item %q: id must be a positive number", item)
+		}
+		ids[strings.TrimSpace(key)] = id
+	}
+	return ids, nil
+}
+
+// Has reports whether the named email can be sent, from a local or a Brevo
+// template
+func (n *Notifier) Has(name string) bool {
+	if n.Templates.Has(name) {
+		return true
+	}
+	for key := range n.BrevoTemplates {
+		if email, _, _ := strings.Cut(key, "."); email == name {
+			return true
+		}
+	}
+	return false
+}
+
+// brevoTemplateId returns the Brevo template of the email in the language,
+// or 0 when the local template is used
+func (n *Notifier) brevoTemplateId(lang, name string) int {
+	if id, ok := n.BrevoTemplates[name+"."+lang]; ok {
+		return id
+	}
+	return n.BrevoTemplates[name]
+}
+
+// sendSlot is when the reminders of a run are delivered
+type sendSlot struct {
+	at time.Time
+	// deferred is set when the reminders must wait for a later run
+	deferred bool
+}
+
+// newSendSlot returns when reminders may be sent from now: now itself when
+// the send window allows it, else the next allowed slot if the mailer can
+// schedule the emails until then, else deferred.
+func newSendSlot(n *Notifier, now time.Time) sendSlot {
+	if n.Window == nil || n.Window.Allows(now) {
+		return sendSlot{at: now}
+	}
+
+	next := n.Window.Next(now)
+	scheduler, ok := n.Mailer.(ScheduledMailer)
+	if next.IsZero() || !ok || next.Sub(now) > scheduler.ScheduleHorizon() {
+		return sendSlot{deferred: true}
+	}
+	return sendSlot{at: next}
+}
+
+// Email builds the named email for the member in the given language, from the
+// Brevo template configured for it or else from the local template
+func (n *Notifier) Email(member baserow.Member, lang, name string, data TemplateData) (brevo.EmailData, error) {
+	var email brevo.EmailData
+	if id := n.brevoTemplateId(lang, name); id != 0 {
+		email = memberEmailData(member, RenderedEmail{})
+		email.TemplateId = id
+		email.Params = brevoParams(n.templateData(member, lang, data), lang)
+	} else {
+		rendered, err := n.Render(member, lang, name, data)
+		if err != nil {
+			return brevo.EmailData{}, err
+		}
+		email = memberEmailData(member, rendered)
+	}
+
+	email.ToEmail, email.Cc = n.Recipients.Recipients(member, name, data.Payment)
+	email.Tags = []string{name, lang}
+	email.ReplyToEmail = n.ReplyTo
+	email.Headers = map[string]string{"X-Mailin-custom": fmt.Sprintf("member:%d|email:%s", member.Id, name)}
+	return email, nil
+}
+
+// Render renders the named template for the member in the given language
+func (n *Notifier) Render(member baserow.Member, lang, name string, data TemplateData) (RenderedEmail, error) {
+	return n.Templates.Render(lang, name, n.templateData(member, lang, data))
+}
+
+// templateData completes data with the member related variables
+func (n *Notifier) templateData(member baserow.Member, lang string, data TemplateData) TemplateData {
+	data.FirstName = toCamelCase(member.FirstName)
+	data.Member = member
+	data.Tier = membershipTier(member, data.Payment)
+	data.RenewalLink = n.Languages.FormUrl(lang)
+	data.Year = membershipYear(data.ExpiryDate, time.Now())
+	return data
+}
+
+// membershipYear returns the year of the next membership period, which starts
+// at the expiry of the current one or now when it already expired. A period
+// starting in November or December is mostly next year.
+func membershipYear(expiry, now time.Time) int {
+	start := now
+	if expiry.After(now) {
+		start = expiry
+	}
+	if start.Month() >= time.November {
+		return start.Year() + 1
+	}
+	return start.Year()
+}
+
+// brevoParams exposes the template variables to Brevo templates, e.g.
+// {{ params.firstName }} or {{ params.expiryDate }}
+func brevoParams(data TemplateData, lang string) map[string]any {
+	params := map[string]any{
+		"firstName":   data.FirstName,
+		"surname":     data.Member.Surname,
+		"email":       data.Member.Email,
+		"language":    lang,
+		"tier":        data.Tier,
+		"renewalLink": data.RenewalLink,
+		"daysLeft":    data.DaysLeft,
+		"year":        data.Year,
+	}
+	if !data.ExpiryDate.IsZero() {
+		params["expiryDate"] = data.ExpiryDate.Format("02/01/2006")
+	}
+	if !data.Payment.OrderDate.IsZero() {
+		params["orderDate"] = data.Payment.OrderDate.Format("02/01/2006")
+		params["orderReference"] = data.Payment.Key()
+		params["amount"] = data.Payment.Amount
+	}
+	return params
+}
+
+// memberEmailData builds an email from Boavizta to the member
+func memberEmailData(member baserow.Member, email RenderedEmail) brevo.EmailData {
+	return brevo.EmailData{
+		SenderName:  "Boavizta",
+		SenderEmail: "no-reply@boavizta.org",
+		ToEmail:     memberAddress(member),
+		ToName:      toCamelCase(member.FirstName) + " " + member.Surname,
+		Subject:     email.Subject,
+		HtmlContent: email.HtmlContent,
+		TextContent: email.TextContent,
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/boavizta/helloasso-renew-contribution/services/brevo"
+	"github.com/boavizta/helloasso-renew-contribution/services/helloasso"
+)
+
+// OutboxEmail is an email planned for a member, with the changes recorded on
+// the member once the email was accepted
+type OutboxEmail struct {
+	Name    string
+	Email   brevo.EmailData
+	Member  baserow.Member
+	Payment helloasso.Payment
+	// OnSent records the email on the member, applied to its working state
+	// when the email was accepted
+	OnSent func(member *baserow.Member)
+}
+
+// Outbox collects the emails of a phase so they can be counted and
+// prioritized before anything is sent, then sent together, in batches when
+// the mailer supports it
+type Outbox struct {
+	phase    string
+	notifier *Notifier
+	states   *MemberStates
+	emails   []OutboxEmail
+}
+
+// OutboxResult counts the outcome of the planned emails
+type OutboxResult struct {
+	Sent   int
+	Failed int
+	// OverQuota is the number of emails not sent because the quota was reached
+	OverQuota int
+}
+
+func newOutbox(phase string, notifier *Notifier, states *MemberStates) *Outbox {
+	return &Outbox{phase: phase, notifier: notifier, states: states}
+}
+
+// Add plans the named email for the member, delivered at the given time when
+// it is in the future. onSent records the email on the member once accepted.
+func (o *Outbox) Add(name string, data TemplateData, at time.Time, member baserow.Member, onSent func(member *baserow.Member)) error {
+	lang := o.notifier.Languages.Resolve(member, data.Payment)
+	email, err := o.notifier.Email(member, lang, name, data)
+	if err != nil {
+		return err
+	}
+	if email.ToEmail == "" {
+		return fmt.Errorf("member %s opted out or has no deliverable address", member.Email)
+	}
+	if at.After(time.Now()) {
+		email.ScheduledAt = at
+	}
+	o.emails = append(o.emails, OutboxEmail{Name: name, Email: email, Member: member, Payment: data.Payment, OnSent: onSent})
+	return nil
+}
+
+// Planned returns the number of planned emails
+func (o *Outbox) Planned() int {
+	return len(o.emails)
+}
+
+// Send sends the planned emails within the quota, organizations first then
+// the oldest memberships, and records the accepted ones on the members
+func (o *Outbox) Send(logger *slog.Logger) OutboxResult {
+	var result OutboxResult
+
+	sort.SliceStable(o.emails, func(i, j int) bool {
+		a, b := o.emails[i].Member, o.emails[j].Member
+		if (a.MembershipType == OrganizationTypeId) != (b.MembershipType == OrganizationTypeId) {
+			return a.MembershipType == OrganizationTypeId
+		}
+		return a.LastPaymentDate.Before(b.LastPaymentDate)
+	})
+
+	granted, err := o.notifier.Quota.Take(len(o.emails))
+	if err != nil {
+		logger.Error("Error reserving email quota", "error", err)
+	}
+	overQuota := o.emails[granted:]
+	planned := o.emails[:granted]
+
+	for _, skipped := range overQuota {
+		logger.Warn("Email quota reached, email not sent", "member", skipped.Member.Email, "email", skipped.Name)
+	}
+	result.OverQuota = len(overQuota)
+
+	var errs []error
+	if batchMailer, ok := o.notifier.Mailer.(BatchMailer); ok && len(planned) > 0 {
+		emails := make([]brevo.EmailData, len(planned))
+		for i, email := range planned {
+			emails[i] = email.Email
+		}
+		errs = batchMailer.SendBatch(emails)
+	} else {
+		errs = make([]error, len(planned))
+		for i, email := range planned {
+			errs[i] = o.notifier.Mailer.Send(email.Email)
+		}
+	}
+
+	for i, email := range planned {
+		if errs[i] != nil {
+			logger.Error("Error sending email notification", "error", errs[i], "member", email.Member.Email, "email", email.Name)
+			result.Failed++
+			continue
+		}
+		logger.Info("Sent email", "member", email.Member.Email, "email", email.Name)
+		o.notifier.Audit.AddEmail(o.phase, email.Name, email.Email, email.Member, email.Payment)
+		result.Sent++
+
+		member := o.states.Current(email.Member)
+		email.OnSent(&member)
+		o.states.Update(o.phase, member, email.Payment, logger)
+	}
+
+	o.emails = nil
+	return result
+}
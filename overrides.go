@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+)
+
+// MemberOverride is the merge of all active overrides targeting one member
+type MemberOverride struct {
+	Reasons         []string
+	NeverDeactivate bool
+	NeverEmail      bool
+}
+
+// Reason returns the reasons of the merged overrides as a single string
+func (o MemberOverride) Reason() string {
+	return strings.Join(o.Reasons, "; ")
+}
+
+// MemberOverrides indexes active overrides by Baserow member ID
+type MemberOverrides map[int]MemberOverride
+
+// newMemberOverrides keeps the overrides active at the given time and merges
+// them per member. Expired overrides are ignored.
+func newMemberOverrides(overrides []baserow.Override, now time.Time) MemberOverrides {
+	result := MemberOverrides{}
+	for _, override := range overrides {
+		if !override.IsActive(now) {
+			continue
+		}
+		for _, memberId := range override.MemberIds {
+			merged := result[memberId]
+			if override.Reason != "" {
+				merged.Reasons = append(merged.Reasons, override.Reason)
+			}
+			merged.NeverDeactivate = merged.NeverDeactivate || override.NeverDeactivate
+			merged.NeverEmail = merged.NeverEmail || override.NeverEmail
+			result[memberId] = merged
+		}
+	}
+	return result
+}
+
+// NeverDeactivate reports whether the member must be kept active whatever
+// the payments say.
+func (o MemberOverrides) NeverDeactivate(memberId int) bool {
+	return o[memberId].NeverDeactivate
+}
+
+// NeverEmail reports whether the member must never receive automatic emails.
+func (o MemberOverrides) NeverEmail(memberId int) bool {
+	return o[memberId].NeverEmail
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+)
+
+// loadPreExpiryOffsets parses PRE_EXPIRY_REMINDER_DAYS, e.g. "30,7": one
+// reminder 30 days before the membership expires, another one 7 days before.
+// Pre-expiry reminders are disabled when the value is empty.
+func loadPreExpiryOffsets(value string) ([]int, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var offsets []int
+	for _, item := range strings.Split(value, ",") {
+		days, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("invalid pre-expiry reminder days %q", item)
+		}
+		offsets = append(offsets, days)
+	}
+
+	// Earliest reminder (largest number of days) first
+	slices.Sort(offsets)
+	slices.Reverse(offsets)
+	return slices.Compact(offsets), nil
+}
+
+// membershipExpiry returns the date a paid membership expires
+func membershipExpiry(paymentDate time.Time) time.Time {
+	return paymentDate.AddDate(0, 12, 0)
+}
+
+// planPreExpiryReminders plans a reminder to active members with a paid
+// membership that it expires soon. Reminders are tracked in the "Last
+// Pre-Expiry Email Date" and "Number of Pre-Expiry Emails" columns,
+// independently of the post-expiry renewal reminders, and reset when a new
+// payment is recorded.
+func planPreExpiryReminders(pairs []MemberPaymentPair, offsets []int, notifier *Notifier, states *MemberStates, outbox *Outbox, report *RunReport, logger *slog.Logger) {
+	now := time.Now()
+
+	slot := newSendSlot(notifier, now)
+	if slot.deferred {
+		logger.Info("Outside of the send window, pre-expiry reminders are deferred to a later run")
+		return
+	}
+
+	for _, pair := range pairs {
+		member := states.Current(pair.Member)
+		payment := pair.Payment
+
+		// Free memberships are not reminded, expired ones get renewal reminders
+		if payment.Amount == 0 {
+			continue
+		}
+		expiry := membershipExpiry(payment.OrderDate)
+		if !expiry.After(now) {
+			continue
+		}
+
+		// Reminders already sent for this membership period
+		sent := member.NumberPreExpiryEmails
+		if !sameDay(member.LastPaymentDate, payment.OrderDate) {
+			sent = 0
+		}
+
+		// Number of reminders that should have been sent by now. Only the
+		// latest one is sent when several are due at once.
+		daysLeft := int(math.Ceil(expiry.Sub(now).Hours() / 24))
+		due := 0
+		for _, days := range offsets {
+			if daysLeft <= days {
+				due++
+			}
+		}
+		if due <= sent {
+			continue
+		}
+
+		if report.Overrides.NeverEmail(member.Id) {
+			report.addOverrideDecision(member, "pre-expiry reminder not sent")
+			continue
+		}
+		if memberAddress(member) == "" {
+			logger.Debug("No deliverable address, pre-expiry reminder not sent", "member", member.Email)
+			continue
+		}
+
+		data := TemplateData{Payment: payment, ExpiryDate: expiry, DaysLeft: daysLeft}
+		err := outbox.Add("pre-expiry", data, slot.at, member, func(sent *baserow.Member) {
+			sent.LastPreExpiryEmailDate = slot.at
+			sent.NumberPreExpiryEmails = due
+		})
+		if err != nil {
+			logger.Error("Error rendering pre-expiry reminder", "error", err, "member", member.Email)
+			continue
+		}
+		logger.Debug("Planned pre-expiry reminder", "member", member.Email, "expiry", expiry.Format("2006-01-02"), "daysLeft", daysLeft)
+	}
+
+	logger.Info("Planned pre-expiry reminders", "count", outbox.Planned())
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultQuotaStateFile keeps the number of emails sent today across runs
+const defaultQuotaStateFile = ".email-quota.json"
+
+// quotaState is the content of the quota state file
+type quotaState struct {
+	Date string `json:"date"`
+	Sent int    `json:"sent"`
+}
+
+// EmailQuota caps the number of emails sent per run (MAX_EMAILS_PER_RUN) and
+// per day (MAX_EMAILS_PER_DAY). The daily count is kept in a state file
+// (EMAIL_QUOTA_STATE_FILE). A nil quota allows every email.
+type EmailQuota struct {
+	perRun    int
+	perDay    int
+	sentRun   int
+	stateFile string
+	state     quotaState
+}
+
+// loadEmailQuota reads the quota configuration and today's count. It returns
+// nil when no cap is configured.
+func loadEmailQuota() (*EmailQuota, error) {
+	perRun, err := quotaValue("MAX_EMAILS_PER_RUN")
+	if err != nil {
+		return nil, err
+	}
+	perDay, err := quotaValue("MAX_EMAILS_PER_DAY")
+	if err != nil {
+		return nil, err
+	}
+	if perRun == 0 && perDay == 0 {
+		return nil, nil
+	}
+
+	quota := &EmailQuota{perRun: perRun, perDay: perDay, stateFile: os.Getenv("EMAIL_QUOTA_STATE_FILE")}
+	if quota.stateFile == "" {
+		quota.stateFile = defaultQuotaStateFile
+	}
+
+	content, err := os.ReadFile(quota.stateFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &quota.state); err != nil {
+			return nil, fmt.Errorf("invalid email quota state file %s: %w", quota.stateFile, err)
+		}
+	}
+	if today := time.Now().Format("2006-01-02"); quota.state.Date != today {
+		quota.state = quotaState{Date: today}
+	}
+	return quota, nil
+}
+
+// quotaValue reads a positive cap from the environment, 0 when not set
+func quotaValue(name string) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return parsed, nil
+}
+
+// Remaining returns the number of emails that can still be sent, -1 when
+// unlimited
+func (q *EmailQuota) Remaining() int {
+	if q == nil {
+		return -1
+	}
+	remaining := -1
+	if q.perRun > 0 {
+		remaining = q.perRun - q.sentRun
+	}
+	if q.perDay > 0 && (remaining < 0 || q.perDay-q.state.Sent < remaining) {
+		remaining = q.perDay - q.state.Sent
+	}
+	return max(remaining, 0)
+}
+
+// Take reserves up to n emails and returns how many may be sent. The daily
+// count is saved right away, so emails count even when their sending fails.
+func (q *EmailQuota) Take(n int) (int, error) {
+	if q == nil {
+		return n, nil
+	}
+	if remaining := q.Remaining(); remaining >= 0 && n > remaining {
+		n = remaining
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	q.sentRun += n
+	q.state.Sent += n
+	content, err := json.Marshal(q.state)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(q.stateFile, content, 0o644); err != nil {
+		return 0, fmt.Errorf("failed to save email quota state: %w", err)
+	}
+	return n, nil
+}
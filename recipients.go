@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/boavizta/helloasso-renew-contribution/services/helloasso"
+)
+
+// Recipient policies (RECIPIENT_POLICY)
+const (
+	// recipientPrimary sends to the primary email, or the first deliverable
+	// alternative email
+	recipientPrimary = "primary"
+	// recipientMatched sends to the email that matched the payment
+	recipientMatched = "matched"
+	// recipientAll sends to the primary email with the other addresses in CC
+	recipientAll = "all"
+)
+
+// RecipientPolicy chooses the addresses an email to a member is sent to
+type RecipientPolicy struct {
+	Mode string
+	// BillingEmails are the emails sent to the billing contact of
+	// organizations, with the member in CC. Empty when SEND_TO_BILLING_CONTACT
+	// is not "true".
+	BillingEmails map[string]bool
+}
+
+// loadRecipientPolicy reads RECIPIENT_POLICY and SEND_TO_BILLING_CONTACT. The
+// billing contact receives the payment related emails: the reminder stages,
+// the pre-expiry reminder and the thank-you email.
+func loadRecipientPolicy(schedule ReminderSchedule) (RecipientPolicy, error) {
+	policy := RecipientPolicy{Mode: os.Getenv("RECIPIENT_POLICY")}
+	switch policy.Mode {
+	case "":
+		policy.Mode = recipientPrimary
+	case recipientPrimary, recipientMatched, recipientAll:
+	default:
+		return RecipientPolicy{}, fmt.Errorf("invalid RECIPIENT_POLICY %q, expected primary, matched or all", policy.Mode)
+	}
+
+	if os.Getenv("SEND_TO_BILLING_CONTACT") == "true" {
+		policy.BillingEmails = map[string]bool{"pre-expiry": true, "thank-you": true}
+		for _, stage := range schedule {
+			policy.BillingEmails[stage.Name] = true
+		}
+	}
+	return policy, nil
+}
+
+// Recipients returns the address the named email is sent to and the
+// addresses in CC. to is empty when the member opted out or has no
+// deliverable address.
+func (p RecipientPolicy) Recipients(member baserow.Member, name string, payment helloasso.Payment) (to string, cc []string) {
+	to = memberAddress(member)
+	if to == "" {
+		return "", nil
+	}
+
+	var deliverable []string
+	for _, email := range memberEmails(member) {
+		if !isUndeliverable(member, email) {
+			deliverable = append(deliverable, email)
+		}
+	}
+
+	switch p.Mode {
+	case recipientMatched:
+		for _, email := range deliverable {
+			if strings.EqualFold(email, payment.PayerEmail) {
+				to = email
+			}
+		}
+	case recipientAll:
+		cc = deliverable
+	}
+
+	if p.BillingEmails[name] && member.MembershipType == OrganizationTypeId &&
+		member.BillingEmail != "" && !isUndeliverable(member, member.BillingEmail) {
+		cc = append([]string{to}, cc...)
+		to = member.BillingEmail
+	}
+
+	// The To address is never repeated in CC
+	var uniqueCc []string
+	for _, email := range cc {
+		duplicate := strings.EqualFold(email, to)
+		for _, kept := range uniqueCc {
+			duplicate = duplicate || strings.EqualFold(email, kept)
+		}
+		if !duplicate {
+			uniqueCc = append(uniqueCc, email)
+		}
+	}
+	return to, uniqueCc
+}
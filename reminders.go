@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+)
+
+// defaultReminderSchedule is used when REMINDER_SCHEDULE is not set: a
+// friendly reminder when the membership expires, a second reminder 14 days
+// later, a last call 30 days after the first reminder, then nothing.
+const defaultReminderSchedule = "renewal:0,second-reminder:14,last-call:30"
+
+// minReminderGapDays is the minimum delay before a first reminder when the
+// member was already emailed, e.g. when the counter was reset
+const minReminderGapDays = 14
+
+// ReminderStage is one email of the renewal reminder campaign
+type ReminderStage struct {
+	// Name selects the email content of the stage
+	Name string
+	// Offset is the number of days after the first reminder at which the
+	// stage is sent
+	Offset int
+}
+
+// ReminderSchedule is the ordered list of renewal reminders sent to a member
+// whose membership expired. The stage to send is driven by the member's
+// NumberContributionsEmail (reminders already sent) and
+// LastContributionEmailDate (date of the previous reminder).
+type ReminderSchedule []ReminderStage
+
+// loadReminderSchedule parses a schedule such as
+// "renewal:0,second-reminder:14,last-call:30"
+func loadReminderSchedule(value string, notifier *Notifier) (ReminderSchedule, error) {
+	if strings.TrimSpace(value) == "" {
+		value = defaultReminderSchedule
+	}
+
+	var schedule ReminderSchedule
+	for _, item := range strings.Split(value, ",") {
+		name, offsetValue, found := strings.Cut(strings.TrimSpace(item), ":")
+		if !found {
+			return nil, fmt.Errorf("invalid reminder stage %q, expected name:days", item)
+		}
+		offset, err := strconv.Atoi(strings.TrimSpace(offsetValue))
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid reminder stage %q: days must be a positive number", item)
+		}
+		if !notifier.Has(name) {
+			return nil, fmt.Errorf("invalid reminder stage %q: no email template %q", item, name)
+		}
+		if len(schedule) > 0 && offset < schedule[len(schedule)-1].Offset {
+			return nil, fmt.Errorf("invalid reminder stage %q: stages must be in chronological order", item)
+		}
+		schedule = append(schedule, ReminderStage{Name: name, Offset: offset})
+	}
+	return schedule, nil
+}
+
+// NextStage returns the reminder stage due for the member. due is false when
+// the next stage must wait, exhausted is true when every stage was sent.
+func (s ReminderSchedule) NextStage(member baserow.Member, now time.Time) (stage ReminderStage, due bool, exhausted bool) {
+	sent := member.NumberContributionsEmail
+	if sent < 0 {
+		sent = 0
+	}
+	if sent >= len(s) {
+		return ReminderStage{}, false, true
+	}
+
+	stage = s[sent]
+	if member.LastContributionEmailDate.IsZero() {
+		return stage, true, false
+	}
+
+	// Wait the gap between the previous stage and this one
+	wait := minReminderGapDays
+	if sent > 0 {
+		wait = stage.Offset - s[sent-1].Offset
+	}
+	return stage, !member.LastContributionEmailDate.After(now.AddDate(0, 0, -wait)), false
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/samber/lo"
+)
+
+// OverrideDecision records a decision of the reconciliation that was changed
+// by a membership override.
+type OverrideDecision struct {
+	Member   baserow.Member
+	Decision string
+	Reason   string
+}
+
+// RunReport collects what happened during a run, printed after the stats.
+type RunReport struct {
+	Overrides         MemberOverrides
+	OverrideDecisions []OverrideDecision
+	// ExhaustedReminders lists expired members who received every reminder
+	// of the schedule and are no longer emailed
+	ExhaustedReminders []baserow.Member
+	// Undeliverable lists expired members not reminded because they opted
+	// out or have no deliverable address
+	Undeliverable []baserow.Member
+	// DeferredReminders lists expired members whose reminder waits for the
+	// next send window
+	DeferredReminders []baserow.Member
+	// RefusedDeactivations lists the members not deactivated because the
+	// deactivations exceeded MAX_DEACTIVATION_PERCENT, for the reason given
+	RefusedDeactivations       []baserow.Member
+	RefusedDeactivationsReason string
+	// Writes is the outcome of the member writes to Baserow
+	Writes WriteResult
+	// Conflicts lists the member columns changed by several phases
+	Conflicts []MemberConflict
+}
+
+// addOverrideDecision records that an override changed the given decision
+func (r *RunReport) addOverrideDecision(member baserow.Member, decision string) {
+	r.OverrideDecisions = append(r.OverrideDecisions, OverrideDecision{
+		Member:   member,
+		Decision: decision,
+		Reason:   r.Overrides[member.Id].Reason(),
+	})
+}
+
+// Print logs the report
+func (r *RunReport) Print(members []baserow.Member, logger *slog.Logger) {
+	membersById := map[int]baserow.Member{}
+	for _, member := range members {
+		membersById[member.Id] = member
+	}
+
+	logger.Info("Active membership overrides", "count", len(r.Overrides))
+	logger.Info("Listing all active membership overrides:")
+	memberIds := lo.Keys(r.Overrides)
+	slices.Sort(memberIds)
+	for _, memberId := range memberIds {
+		override := r.Overrides[memberId]
+		member := membersById[memberId]
+		fmt.Printf("%d,%s,neverDeactivate=%t,neverEmail=%t,%s\n", memberId, member.Email, override.NeverDeactivate, override.NeverEmail, override.Reason())
+	}
+
+	logger.Info("Decisions changed by membership overrides", "count", len(r.OverrideDecisions))
+	for _, decision := range r.OverrideDecisions {
+		fmt.Printf("%s,%s,%s\n", decision.Member.Email, decision.Decision, decision.Reason)
+	}
+
+	logger.Info("Members who exhausted the reminder schedule", "count", len(r.ExhaustedReminders))
+	for _, member := range r.ExhaustedReminders {
+		fmt.Printf("%s,%s,%d,%s\n", member.Email, member.FirstName+" "+member.Surname, member.NumberContributionsEmail, member.LastContributionEmailDate.Format("2006-01-02"))
+	}
+
+	logger.Info("Renewal reminders deferred to the next send window", "count", len(r.DeferredReminders))
+	for _, member := range r.DeferredReminders {
+		fmt.Printf("%s,%s,%d\n", member.Email, member.FirstName+" "+member.Surname, member.NumberContributionsEmail)
+	}
+
+	if len(r.RefusedDeactivations) > 0 {
+		logger.Error("Deactivations refused by the safety threshold", "count", len(r.RefusedDeactivations), "reason", r.RefusedDeactivationsReason)
+		for _, member := range r.RefusedDeactivations {
+			lastPayment := "none"
+			if !member.LastPaymentDate.IsZero() {
+				lastPayment = member.LastPaymentDate.Format("2006-01-02")
+			}
+			fmt.Printf("%s,%s,%s\n", member.Email, member.FirstName+" "+member.Surname, lastPayment)
+		}
+	}
+
+	logger.Info("Members written to Baserow", "written", r.Writes.Written, "unchanged", r.Writes.Unchanged, "failed", len(r.Writes.Failures))
+	if len(r.Conflicts) > 0 {
+		logger.Warn("Member columns changed by several phases, the later phase won", "count", len(r.Conflicts))
+		for _, conflict := range r.Conflicts {
+			fmt.Printf("%s,%s,%s=%v,%s=%v\n", conflict.Member.Email, conflict.Column, conflict.Phase, conflict.Value, conflict.LaterPhase, conflict.LaterValue)
+		}
+	}
+
+	if len(r.Writes.Failures) > 0 {
+		logger.Error("Member changes not written to Baserow", "count", len(r.Writes.Failures))
+		for _, failure := range r.Writes.Failures {
+			fmt.Printf("%d,%s,%s\n", failure.Member.Id, failure.Member.Email, failure.Err)
+		}
+	}
+
+	logger.Info("Expired members without a deliverable address", "count", len(r.Undeliverable))
+	for _, member := range r.Undeliverable {
+		fmt.Printf("%s,%s,optOut=%t,undeliverable=%s\n", member.Email, member.FirstName+" "+member.Surname, member.EmailOptOut, strings.Join(member.UndeliverableEmails, " "))
+	}
+}
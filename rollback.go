@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/samber/lo"
+)
+
+// rollbackConflict is a column changed by the rolled back run and modified
+// since then, so its row is not restored
+type rollbackConflict struct {
+	Entry   baserow.AuditEntry
+	Current any
+}
+
+// runRollback restores the member columns changed by a previous run to their
+// values before the run, from the audit log. Rows modified since the run are
+// skipped and reported. Emails sent by the run are listed.
+func runRollback(args []string, logger *slog.Logger) int {
+	flags := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "list the changes to restore without writing to Baserow")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: rollback [--dry-run] <run-id>")
+		return 2
+	}
+	runId := flags.Arg(0)
+
+	audit := loadAuditLog(time.Now())
+	if !audit.Enabled() {
+		fmt.Fprintln(os.Stderr, "rollback requires AUDIT_LOG_FILE or BASEROW_AUDIT_TABLE_ID")
+		return 2
+	}
+
+	entries, err := audit.Entries("", runId)
+	if err != nil {
+		logger.Error("Error reading the audit log", "error", err)
+		return 1
+	}
+	if len(entries) == 0 {
+		fmt.Fprintf(os.Stderr, "no recorded change for run %s\n", runId)
+		return 1
+	}
+
+	members, err := baserow.GetMembers()
+	if err != nil {
+		logger.Error("Error fetching members from Baserow", "error", err)
+		return 1
+	}
+	membersById := lo.KeyBy(members, func(member baserow.Member) int {
+		return member.Id
+	})
+
+	var emails []baserow.AuditEntry
+	var memberIds []int
+	changes := map[int][]baserow.AuditEntry{}
+	for _, entry := range entries {
+		if entry.Field == auditEmailField {
+			emails = append(emails, entry)
+			continue
+		}
+		if _, seen := changes[entry.MemberId]; !seen {
+			memberIds = append(memberIds, entry.MemberId)
+		}
+		changes[entry.MemberId] = append(changes[entry.MemberId], entry)
+	}
+
+	var updates []baserow.MemberUpdate
+	var conflicts []rollbackConflict
+	var missing []baserow.AuditEntry
+	for _, memberId := range memberIds {
+		current, ok := membersById[memberId]
+		if !ok {
+			missing = append(missing, changes[memberId][0])
+			continue
+		}
+
+		update := baserow.MemberUpdate{Id: current.Id, Email: current.Email, Fields: map[string]interface{}{}, Previous: map[string]interface{}{}}
+		var rowConflicts []rollbackConflict
+		for _, entry := range changes[memberId] {
+			value := baserow.MemberValue(current, entry.Field)
+			if !sameAuditValue(value, entry.NewValue) {
+				rowConflicts = append(rowConflicts, rollbackConflict{Entry: entry, Current: value})
+				continue
+			}
+			update.Fields[entry.Field] = entry.OldValue
+			update.Previous[entry.Field] = value
+		}
+
+		// Someone changed the row since the run: restoring part of it could
+		// leave an inconsistent membership
+		if len(rowConflicts) > 0 {
+			conflicts = append(conflicts, rowConflicts...)
+			continue
+		}
+		updates = append(updates, update)
+	}
+
+	logger.Info("Rolling back run", "run", runId, "members", len(updates), "conflicts", len(conflicts), "dryRun", *dryRun)
+
+	var failures []baserow.MemberUpdate
+	if *dryRun {
+		for _, update := range updates {
+			for _, column := range slices.Sorted(maps.Keys(update.Fields)) {
+				fmt.Printf("%d,%s,%s,%s -> %s\n", update.Id, update.Email, column, auditValue(update.Previous[column]), auditValue(update.Fields[column]))
+			}
+		}
+	} else {
+		for i, err := range baserow.UpdateMembers(updates) {
+			if err != nil {
+				logger.Error("Error restoring member in Baserow", "error", err, "member", updates[i].Email, "id", updates[i].Id)
+				failures = append(failures, updates[i])
+				continue
+			}
+			for _, column := range slices.Sorted(maps.Keys(updates[i].Fields)) {
+				audit.Add(baserow.AuditEntry{
+					MemberId: updates[i].Id,
+					Email:    updates[i].Email,
+					Field:    column,
+					OldValue: updates[i].Previous[column],
+					NewValue: updates[i].Fields[column],
+					Phase:    "rollback of " + runId,
+				})
+			}
+		}
+		if err := audit.Flush(); err != nil {
+			logger.Error("Error recording the rollback in the audit log", "error", err)
+		}
+		logger.Info("Restored members", "count", len(updates)-len(failures), "failed", len(failures), "rollbackRun", audit.RunId)
+	}
+
+	logger.Info("Members modified since the run, not restored", "count", len(conflicts))
+	for _, conflict := range conflicts {
+		fmt.Printf("%d,%s,%s,run set %s,now %s\n", conflict.Entry.MemberId, conflict.Entry.Email, conflict.Entry.Field, auditValue(conflict.Entry.NewValue), auditValue(conflict.Current))
+	}
+
+	logger.Info("Members of the run no longer in Baserow", "count", len(missing))
+	for _, entry := range missing {
+		fmt.Printf("%d,%s\n", entry.MemberId, entry.Email)
+	}
+
+	logger.Info("Emails sent by the run, they can't be unsent", "count", len(emails))
+	for _, entry := range emails {
+		fmt.Printf("%s,%s,%s,%s\n", entry.Time.Local().Format("2006-01-02 15:04"), entry.Email, entry.Phase, entry.NewValue)
+	}
+
+	if len(failures) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// sameAuditValue compares a column value with a value read back from the
+// audit log, where numbers are decoded as floats
+func sameAuditValue(value, recorded any) bool {
+	a, errA := json.Marshal(value)
+	b, errB := json.Marshal(recorded)
+	return errA == nil && errB == nil && string(a) == string(b)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxWindowSearch bounds the search of the next allowed send slot
+const maxWindowSearch = 400 * 24 * time.Hour
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// blackout is a range of dates during which no reminder is sent. Recurring
+// ranges (year 0) apply every year and may span the new year.
+type blackout struct {
+	from, to  time.Time
+	recurring bool
+}
+
+// SendWindow restricts when reminders are sent: days of the week, hours of
+// the day and blackout date ranges, in the window location
+type SendWindow struct {
+	days      map[time.Weekday]bool
+	fromHour  int
+	toHour    int
+	blackouts []blackout
+	location  *time.Location
+}
+
+// loadSendWindow reads SEND_DAYS ("mon-fri"), SEND_HOURS ("9-18"),
+// SEND_BLACKOUTS ("08-01:08-31,12-20:01-05" or full dates) and SEND_TIMEZONE.
+// Nothing set allows sending at any time.
+func loadSendWindow() (*SendWindow, error) {
+	window := &SendWindow{fromHour: 0, toHour: 24, location: time.Local}
+
+	if value := os.Getenv("SEND_TIMEZONE"); value != "" {
+		location, err := time.LoadLocation(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SEND_TIMEZONE %q: %w", value, err)
+		}
+		window.location = location
+	}
+
+	if value := strings.TrimSpace(os.Getenv("SEND_DAYS")); value != "" {
+		window.days = map[time.Weekday]bool{}
+		for _, item := range strings.Split(value, ",") {
+			fromName, toName, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(item)), "-")
+			if !isRange {
+				toName = fromName
+			}
+			from, okFrom := weekdays[strings.TrimSpace(fromName)]
+			to, okTo := weekdays[strings.TrimSpace(toName)]
+			if !okFrom || !okTo {
+				return nil, fmt.Errorf("invalid SEND_DAYS item %q, expected a day (mon) or a range (mon-fri)", item)
+			}
+			for day := from; ; day = (day + 1) % 7 {
+				window.days[day] = true
+				if day == to {
+					break
+				}
+			}
+		}
+	}
+
+	if value := strings.TrimSpace(os.Getenv("SEND_HOURS")); value != "" {
+		fromValue, toValue, _ := strings.Cut(value, "-")
+		from, errFrom := strconv.Atoi(strings.TrimSpace(fromValue))
+		to, errTo := strconv.Atoi(strings.TrimSpace(toValue))
+		if errFrom != nil || errTo != nil || from < 0 || to > 24 || from >= to {
+			return nil, fmt.Errorf("invalid SEND_HOURS %q, expected from-to hours such as 9-18", value)
+		}
+		window.fromHour, window.toHour = from, to
+	}
+
+	if value := strings.TrimSpace(os.Getenv("SEND_BLACKOUTS")); value != "" {
+		for _, item := range strings.Split(value, ",") {
+			period, err := parseBlackout(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("invalid SEND_BLACKOUTS item %q: %w", item, err)
+			}
+			window.blackouts = append(window.blackouts, period)
+		}
+	}
+
+	return window, nil
+}
+
+// parseBlackout parses "MM-DD:MM-DD" (every year) or
+// "YYYY-MM-DD:YYYY-MM-DD", both ends included
+func parseBlackout(value string) (blackout, error) {
+	fromValue, toValue, found := strings.Cut(value, ":")
+	if !found {
+		return blackout{}, fmt.Errorf("expected from:to dates")
+	}
+
+	layout := "2006-01-02"
+	recurring := len(strings.TrimSpace(fromValue)) == len("01-02")
+	if recurring {
+		layout = "01-02"
+	}
+	from, err := time.Parse(layout, strings.TrimSpace(fromValue))
+	if err != nil {
+		return blackout{}, err
+	}
+	to, err := time.Parse(layout, strings.TrimSpace(toValue))
+	if err != nil {
+		return blackout{}, err
+	}
+	if !recurring && to.Before(from) {
+		return blackout{}, fmt.Errorf("end date is before start date")
+	}
+	return blackout{from: from, to: to, recurring: recurring}, nil
+}
+
+// contains reports whether the day of t is in the blackout
+func (b blackout) contains(t time.Time) bool {
+	if !b.recurring {
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return !day.Before(b.from) && !day.After(b.to)
+	}
+
+	day := time.Date(0, t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	from := time.Date(0, b.from.Month(), b.from.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(0, b.to.Month(), b.to.Day(), 0, 0, 0, 0, time.UTC)
+	if from.After(to) {
+		// Spans the new year, e.g. 12-20:01-05
+		return !day.Before(from) || !day.After(to)
+	}
+	return !day.Before(from) && !day.After(to)
+}
+
+// Allows reports whether reminders may be sent at t
+func (w *SendWindow) Allows(t time.Time) bool {
+	t = t.In(w.location)
+	if w.days != nil && !w.days[t.Weekday()] {
+		return false
+	}
+	if t.Hour() < w.fromHour || t.Hour() >= w.toHour {
+		return false
+	}
+	for _, period := range w.blackouts {
+		if period.contains(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Next returns the first time from t at which reminders may be sent: t
+// itself, or the start of the next allowed hour. It returns a zero time when
+// nothing is allowed in the coming year.
+func (w *SendWindow) Next(t time.Time) time.Time {
+	if w.Allows(t) {
+		return t
+	}
+	// Slots start on the hour of the window timezone, which is not a whole
+	// number of hours from UTC in every zone
+	local := t.In(w.location)
+	for hour := local.Hour() + 1; ; hour++ {
+		slot := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, w.location)
+		if slot.Sub(t) >= maxWindowSearch {
+			return time.Time{}
+		}
+		if slot.After(t) && w.Allows(slot) {
+			return slot
+		}
+	}
+}
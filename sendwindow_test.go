@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendWindowNext(t *testing.T) {
+	paris := loadLocation(t, "Europe/Paris")
+	kolkata := loadLocation(t, "Asia/Kolkata")
+
+	tests := []struct {
+		name      string
+		days      string
+		hours     string
+		blackouts string
+		timezone  string
+		from      time.Time
+		expected  time.Time
+	}{
+		{
+			name:     "within the window",
+			days:     "mon-fri",
+			hours:    "9-18",
+			timezone: "Europe/Paris",
+			from:     time.Date(2026, 10, 14, 10, 25, 0, 0, paris),
+			expected: time.Date(2026, 10, 14, 10, 25, 0, 0, paris),
+		},
+		{
+			name:     "later the same day",
+			days:     "mon-fri",
+			hours:    "9-18",
+			timezone: "Europe/Paris",
+			from:     time.Date(2026, 10, 14, 7, 40, 0, 0, paris),
+			expected: time.Date(2026, 10, 14, 9, 0, 0, 0, paris),
+		},
+		{
+			name:     "weekend rollover",
+			days:     "mon-fri",
+			hours:    "9-18",
+			timezone: "Europe/Paris",
+			from:     time.Date(2026, 10, 16, 18, 30, 0, 0, paris),
+			expected: time.Date(2026, 10, 19, 9, 0, 0, 0, paris),
+		},
+		{
+			name:     "days range across the week end",
+			days:     "sat-mon",
+			hours:    "9-18",
+			timezone: "Europe/Paris",
+			from:     time.Date(2026, 10, 13, 12, 0, 0, 0, paris),
+			expected: time.Date(2026, 10, 17, 9, 0, 0, 0, paris),
+		},
+		{
+			name:     "spring forward",
+			hours:    "9-18",
+			timezone: "Europe/Paris",
+			from:     time.Date(2026, 3, 28, 20, 0, 0, 0, paris),
+			expected: time.Date(2026, 3, 29, 9, 0, 0, 0, paris),
+		},
+		{
+			name:     "spring forward in the skipped hour",
+			hours:    "2-4",
+			timezone: "Europe/Paris",
+			from:     time.Date(2026, 3, 29, 1, 30, 0, 0, paris),
+			expected: time.Date(2026, 3, 29, 3, 0, 0, 0, paris),
+		},
+		{
+			name:     "fall back",
+			hours:    "9-18",
+			timezone: "Europe/Paris",
+			from:     time.Date(2026, 10, 24, 22, 30, 0, 0, paris),
+			expected: time.Date(2026, 10, 25, 9, 0, 0, 0, paris),
+		},
+		{
+			name:     "half hour offset timezone",
+			hours:    "9-18",
+			timezone: "Asia/Kolkata",
+			from:     time.Date(2026, 10, 18, 20, 15, 0, 0, kolkata),
+			expected: time.Date(2026, 10, 19, 9, 0, 0, 0, kolkata),
+		},
+		{
+			name:      "blackout spanning the new year",
+			days:      "mon-fri",
+			hours:     "9-18",
+			blackouts: "12-20:01-05",
+			timezone:  "Europe/Paris",
+			from:      time.Date(2026, 12, 18, 18, 0, 0, 0, paris),
+			expected:  time.Date(2027, 1, 6, 9, 0, 0, 0, paris),
+		},
+		{
+			name:      "dated blackout",
+			hours:     "9-18",
+			blackouts: "2026-05-01:2026-05-08",
+			timezone:  "Europe/Paris",
+			from:      time.Date(2026, 5, 3, 11, 0, 0, 0, paris),
+			expected:  time.Date(2026, 5, 9, 9, 0, 0, 0, paris),
+		},
+		{
+			name:      "nothing allowed",
+			blackouts: "01-01:12-31",
+			timezone:  "Europe/Paris",
+			from:      time.Date(2026, 5, 3, 11, 0, 0, 0, paris),
+			expected:  time.Time{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("SEND_DAYS", test.days)
+			t.Setenv("SEND_HOURS", test.hours)
+			t.Setenv("SEND_BLACKOUTS", test.blackouts)
+			t.Setenv("SEND_TIMEZONE", test.timezone)
+
+			window, err := loadSendWindow()
+			if err != nil {
+				t.Fatalf("loadSendWindow() error = %v", err)
+			}
+			if next := window.Next(test.from); !next.Equal(test.expected) {
+				t.Errorf("Next(%v) = %v, expected %v", test.from, next, test.expected)
+			}
+		})
+	}
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s not available: %v", name, err)
+	}
+	return location
+}
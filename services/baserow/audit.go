@@ -0,0 +1,95 @@
+package baserow
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// AuditEntry is a change applied to a member by a run, stored in the
+// "Membership audit" table or in the local audit log file
+type AuditEntry struct {
+	RunId    string    `json:"runId"`
+	Time     time.Time `json:"time"`
+	MemberId int       `json:"memberId"`
+	Email    string    `json:"email"`
+	Field    string    `json:"field"`
+	OldValue any       `json:"oldValue"`
+	NewValue any       `json:"newValue"`
+	// Phase is the phase of the run which made the change
+	Phase string `json:"phase"`
+	// Payment describes the payment matched by the phase, if any
+	Payment string `json:"payment,omitempty"`
+}
+
+// AddAuditEntries appends the entries to the membership audit table, with the
+// batch rows endpoint. Values are stored as JSON, so that empty values and
+// types can be told apart.
+func AddAuditEntries(entries []AuditEntry) error {
+	tableID := os.Getenv("BASEROW_AUDIT_TABLE_ID")
+	if tableID == "" {
+		return fmt.Errorf("BASEROW_AUDIT_TABLE_ID environment variable must be set")
+	}
+	apiURL := fmt.Sprintf("https://baserow.boavizta.org/api/database/rows/table/%s/batch/?user_field_names=true", tableID)
+
+	for _, batch := range lo.Chunk(entries, maxBatchRows) {
+		items := make([]map[string]interface{}, len(batch))
+		for i, entry := range batch {
+			oldValue, _ := json.Marshal(entry.OldValue)
+			newValue, _ := json.Marshal(entry.NewValue)
+			items[i] = map[string]interface{}{
+				"Run":       entry.RunId,
+				"Date":      entry.Time.UTC().Format(time.RFC3339),
+				"Member Id": entry.MemberId,
+				"E-mail":    entry.Email,
+				"Field":     entry.Field,
+				"Old Value": string(oldValue),
+				"New Value": string(newValue),
+				"Phase":     entry.Phase,
+				"Payment":   entry.Payment,
+			}
+		}
+		if err := writeRows("POST", apiURL, map[string]interface{}{"items": items}); err != nil {
+			return fmt.Errorf("failed to add audit entries: %w", err)
+		}
+	}
+
+	slog.Info("Successfully added audit entries to Baserow", "count", len(entries))
+	return nil
+}
+
+// GetAuditEntries fetches the audit entries whose column equals the value,
+// e.g. the entries of a member ("E-mail") or of a run ("Run")
+func GetAuditEntries(column string, value string) ([]AuditEntry, error) {
+	tableID := os.Getenv("BASEROW_AUDIT_TABLE_ID")
+	if tableID == "" {
+		return nil, fmt.Errorf("BASEROW_AUDIT_TABLE_ID environment variable must be set")
+	}
+
+	rows, err := getRowsWhere(tableID, url.Values{"filter__" + column + "__equal": {value}})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []AuditEntry
+	for _, result := range rows {
+		entry := AuditEntry{
+			RunId:    getStringValue(result, "Run"),
+			MemberId: int(getDecimalValue(result, "Member Id")),
+			Email:    getStringValue(result, "E-mail"),
+			Field:    getStringValue(result, "Field"),
+			Phase:    getStringValue(result, "Phase"),
+			Payment:  getStringValue(result, "Payment"),
+		}
+		entry.Time, _ = time.Parse(time.RFC3339, getStringValue(result, "Date"))
+		_ = json.Unmarshal([]byte(getStringValue(result, "Old Value")), &entry.OldValue)
+		_ = json.Unmarshal([]byte(getStringValue(result, "New Value")), &entry.NewValue)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -7,7 +7,10 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"reflect"
+	"strings"
 	"time"
 )
 
@@ -21,10 +24,18 @@ type Member struct {
 	Email                     string    `json:"E-mail"`
 	AlternativeEmail1         string    `json:"AlternativeEmail1"`
 	AlternativeEmail2         string    `json:"AlternativeEmail2"`
+	BillingEmail              string    `json:"Billing Email"`
 	ActiveMembership          bool      `json:"Active MemberShip"`
 	LastPaymentDate           time.Time `json:"Last Payment Date"`
 	LastContributionEmailDate time.Time `json:"Last Contribution Email Date"`
 	NumberContributionsEmail  int       `json:"Number of Contributions Email"`
+	LastPreExpiryEmailDate    time.Time `json:"Last Pre-Expiry Email Date"`
+	NumberPreExpiryEmails     int       `json:"Number of Pre-Expiry Emails"`
+	LastThankedOrder          string    `json:"Last Thanked Order"`
+	WelcomeEmailStep          int       `json:"Welcome Email Step"`
+	LastWelcomeEmailDate      time.Time `json:"Last Welcome Email Date"`
+	UndeliverableEmails       []string  `json:"Undeliverable Emails"`
+	EmailOptOut               bool      `json:"Email Opt-Out"`
 	MembershipType            int       `json:"Membership Type"`
 	PreferredLanguages        []int     `json:"Preferred languages"`
 	Country                   string    `json:"Country"`
@@ -42,19 +53,127 @@ type BaserowResponse struct {
 func GetMembers() ([]Member, error) {
 	slog.Info("Fetching members from Baserow")
 
+	tableID := os.Getenv("BASEROW_MEMBER_TABLE_ID")
+	if tableID == "" {
+		return nil, fmt.Errorf("BASEROW_MEMBER_TABLE_ID environment variable must be set")
+	}
+
+	rows, err := getRows(tableID)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []Member
+	for _, result := range rows {
+		members = append(members, parseMember(result))
+	}
+
+	slog.Info("Successfully fetched all members from Baserow", "count", len(members))
+	return members, nil
+}
+
+// GetMember fetches a single member by its Baserow row ID
+func GetMember(id int) (Member, error) {
+	tableID := os.Getenv("BASEROW_MEMBER_TABLE_ID")
+	if tableID == "" {
+		return Member{}, fmt.Errorf("BASEROW_MEMBER_TABLE_ID environment variable must be set")
+	}
+
+	row, err := getRow(tableID, id)
+	if err != nil {
+		return Member{}, err
+	}
+	return parseMember(row), nil
+}
+
+// parseMember maps a row of the member table to a Member
+func parseMember(result map[string]interface{}) Member {
+	member := Member{
+		Id:                       getIntValue(result, "id"),
+		Surname:                  getStringValue(result, "Surname"),
+		FirstName:                getStringValue(result, "First name"),
+		Email:                    getStringValue(result, "E-mail"),
+		AlternativeEmail1:        getStringValue(result, "AlternativeEmail1"),
+		AlternativeEmail2:        getStringValue(result, "AlternativeEmail2"),
+		BillingEmail:             getStringValue(result, "Billing Email"),
+		Country:                  getLinkedValue(result, "Country"),
+		ActiveMembership:         getBoolValue(result, "Active MemberShip"),
+		NumberContributionsEmail: int(getDecimalValue(result, "Number of Contributions Email")),
+		NumberPreExpiryEmails:    int(getDecimalValue(result, "Number of Pre-Expiry Emails")),
+		LastThankedOrder:         getStringValue(result, "Last Thanked Order"),
+		WelcomeEmailStep:         int(getDecimalValue(result, "Welcome Email Step")),
+		UndeliverableEmails:      getListValue(result, "Undeliverable Emails"),
+		EmailOptOut:              getBoolValue(result, "Email Opt-Out"),
+		MembershipType:           getSelectId(result, "Membership type"),
+		PreferredLanguages:       getMultiSelectIds(result, "Preferred languages"),
+	}
+
+	// Handle the date fields separately as they require parsing
+	member.LastPaymentDate = getDateValue(result, "Last Payment Date")
+	member.LastContributionEmailDate = getDateValue(result, "Last Contribution Email Date")
+	member.LastPreExpiryEmailDate = getDateValue(result, "Last Pre-Expiry Email Date")
+	member.LastWelcomeEmailDate = getDateValue(result, "Last Welcome Email Date")
+
+	return member
+}
+
+// getRow fetches a single row of a Baserow table
+func getRow(tableID string, rowID int) (map[string]interface{}, error) {
 	apiToken := os.Getenv("BASEROW_API_TOKEN")
 	if apiToken == "" {
 		return nil, fmt.Errorf("BASEROW_API_TOKEN environment variable must be set")
 	}
 
-	tableID := os.Getenv("BASEROW_MEMBER_TABLE_ID")
-	if tableID == "" {
-		return nil, fmt.Errorf("BASEROW_MEMBER_TABLE_ID environment variable must be set")
+	apiURL := fmt.Sprintf("https://baserow.boavizta.org/api/database/rows/table/%s/%d/?user_field_names=true", tableID, rowID)
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		slog.Error("Failed to create request", "error", err)
+		return nil, err
 	}
-	apiURL := fmt.Sprintf("https://baserow.boavizta.org/api/database/rows/table/%s/?user_field_names=true", tableID)
+
+	req.Header.Add("Authorization", "Token "+apiToken)
 
 	client := &http.Client{}
-	var members []Member
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Error("Failed to send request", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		slog.Error("Failed to get row", "table", tableID, "id", rowID, "status", resp.StatusCode, "response", string(body))
+		return nil, fmt.Errorf("failed to get row %d of table %s: %s, status code: %d", rowID, tableID, string(body), resp.StatusCode)
+	}
+
+	var row map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&row); err != nil {
+		slog.Error("Failed to decode response", "error", err)
+		return nil, err
+	}
+	return row, nil
+}
+
+// getRows fetches all rows of a Baserow table, following pagination
+func getRows(tableID string) ([]map[string]interface{}, error) {
+	return getRowsWhere(tableID, url.Values{})
+}
+
+// getRowsWhere fetches the rows of a Baserow table matching the filters
+// (e.g. "filter__E-mail__equal"), following pagination
+func getRowsWhere(tableID string, filters url.Values) ([]map[string]interface{}, error) {
+	apiToken := os.Getenv("BASEROW_API_TOKEN")
+	if apiToken == "" {
+		return nil, fmt.Errorf("BASEROW_API_TOKEN environment variable must be set")
+	}
+
+	filters.Set("user_field_names", "true")
+	apiURL := fmt.Sprintf("https://baserow.boavizta.org/api/database/rows/table/%s/?%s", tableID, filters.Encode())
+
+	client := &http.Client{}
+	var rows []map[string]interface{}
 
 	// Loop to handle pagination
 	for apiURL != "" {
@@ -75,8 +194,8 @@ func GetMembers() ([]Member, error) {
 		if resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
-			slog.Error("Failed to get members", "status", resp.StatusCode, "response", string(body))
-			return nil, fmt.Errorf("failed to get members: %s, status code: %d", string(body), resp.StatusCode)
+			slog.Error("Failed to get rows", "table", tableID, "status", resp.StatusCode, "response", string(body))
+			return nil, fmt.Errorf("failed to get rows of table %s: %s, status code: %d", tableID, string(body), resp.StatusCode)
 		}
 
 		var baserowResp BaserowResponse
@@ -87,50 +206,17 @@ func GetMembers() ([]Member, error) {
 		}
 		resp.Body.Close()
 
-		// Process the results from this page
-		for _, result := range baserowResp.Results {
-			member := Member{
-				Id:                       getIntValue(result, "id"),
-				Surname:                  getStringValue(result, "Surname"),
-				FirstName:                getStringValue(result, "First name"),
-				Email:                    getStringValue(result, "E-mail"),
-				AlternativeEmail1:        getStringValue(result, "AlternativeEmail1"),
-				AlternativeEmail2:        getStringValue(result, "AlternativeEmail2"),
-				Country:                  getLinkedValue(result, "Country"),
-				ActiveMembership:         getBoolValue(result, "Active MemberShip"),
-				NumberContributionsEmail: getIntValue(result, "Number of Contributions Email"),
-				MembershipType:           getSelectId(result, "Membership type"),
-				PreferredLanguages:       getMultiSelectIds(result, "Preferred languages"),
-			}
-
-			// Handle the date fields separately as they require parsing
-			if dateStr, ok := result["Last Payment Date"].(string); ok && dateStr != "" {
-				date, err := time.Parse("2006-01-02", dateStr)
-				if err == nil {
-					member.LastPaymentDate = date
-				}
-			}
-
-			if dateStr, ok := result["Last Contribution Email Date"].(string); ok && dateStr != "" {
-				date, err := time.Parse("2006-01-02", dateStr)
-				if err == nil {
-					member.LastContributionEmailDate = date
-				}
-			}
-
-			members = append(members, member)
-		}
+		rows = append(rows, baserowResp.Results...)
 
 		// Update URL for the next page or exit the loop if there's no next page
 		apiURL = baserowResp.Next
 
 		if apiURL != "" {
-			slog.Info("Fetching next page of members", "url", apiURL)
+			slog.Info("Fetching next page of rows", "table", tableID, "url", apiURL)
 		}
 	}
 
-	slog.Info("Successfully fetched all members from Baserow", "count", len(members))
-	return members, nil
+	return rows, nil
 }
 
 // Helper functions to safely extract values from the map
@@ -190,6 +276,18 @@ func getIntValue(data map[string]interface{}, key string) int {
 	return 0
 }
 
+func getDateValue(data map[string]interface{}, key string) time.Time {
+	if dateStr, ok := data[key].(string); ok && dateStr != "" {
+		date, err := time.Parse("2006-01-02", dateStr)
+		if err == nil {
+			return date
+		}
+	}
+	return time.Time{}
+}
+
+// getMultiSelectIds returns the ids of a multiple select or a link row field,
+// both are serialized as a list of {id, value} objects.
 func getMultiSelectIds(data map[string]interface{}, key string) []int {
 	var ids []int
 	if val, ok := data[key].([]interface{}); ok {
@@ -204,28 +302,95 @@ func getMultiSelectIds(data map[string]interface{}, key string) []int {
 	return ids
 }
 
-// UpdateMember updates a member's information in the Baserow database
-func UpdateMember(member Member) error {
-	slog.Debug("Updating member in Baserow", "id", member.Id, "email", member.Email)
+// getListValue splits a text field holding a comma or newline separated list
+func getListValue(data map[string]interface{}, key string) []string {
+	var values []string
+	for _, value := range strings.FieldsFunc(getStringValue(data, key), func(r rune) bool { return r == ',' || r == '\n' }) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
 
-	apiToken := os.Getenv("BASEROW_API_TOKEN")
-	if apiToken == "" {
-		return fmt.Errorf("BASEROW_API_TOKEN environment variable must be set")
+// MemberUpdate holds the changed columns of a member row, with their values
+// before the change in Previous
+type MemberUpdate struct {
+	Id       int
+	Email    string
+	Fields   map[string]interface{}
+	Previous map[string]interface{}
+}
+
+// MemberDiff returns the update writing the columns of updated that differ
+// from original, the member as fetched. Cleared dates are written as null.
+func MemberDiff(original, updated Member) MemberUpdate {
+	before, after := memberFields(original), memberFields(updated)
+	update := MemberUpdate{Id: updated.Id, Email: updated.Email, Fields: map[string]interface{}{}, Previous: map[string]interface{}{}}
+	for column, value := range after {
+		if !reflect.DeepEqual(before[column], value) {
+			update.Fields[column] = value
+			update.Previous[column] = before[column]
+		}
 	}
+	return update
+}
+
+// UpdateMember writes the changed columns of a member in the Baserow database
+func UpdateMember(update MemberUpdate) error {
+	slog.Debug("Updating member in Baserow", "id", update.Id, "email", update.Email, "fields", update.Fields)
 
 	tableID := os.Getenv("BASEROW_MEMBER_TABLE_ID")
 	if tableID == "" {
 		return fmt.Errorf("BASEROW_MEMBER_TABLE_ID environment variable must be set")
+	}
+	apiURL := fmt.Sprintf("https://baserow.boavizta.org/api/database/rows/table/%s/%d/?user_field_names=true", tableID, update.Id)
 
+	if err := writeRows("PATCH", apiURL, update.Fields); err != nil {
+		return fmt.Errorf("failed to update member: %w", err)
 	}
-	apiURL := fmt.Sprintf("https://baserow.boavizta.org/api/database/rows/table/%s/%d/?user_field_names=true", tableID, member.Id)
 
-	// Prepare the update payload
-	payload := map[string]interface{}{
+	slog.Info("Successfully updated member in Baserow", "id", update.Id, "email", update.Email)
+	return nil
+}
+
+// MemberValue returns the value of a column written by the reconciliation,
+// as sent to Baserow
+func MemberValue(member Member, column string) interface{} {
+	return memberFields(member)[column]
+}
+
+// memberFields returns the columns of the member written by the
+// reconciliation, with nil for empty dates
+func memberFields(member Member) map[string]interface{} {
+	return map[string]interface{}{
 		"Active MemberShip":             member.ActiveMembership,
-		"Last Payment Date":             member.LastPaymentDate.Format("2006-01-02"),
-		"Last Contribution Email Date":  member.LastContributionEmailDate.Format("2006-01-02"),
+		"Last Payment Date":             dateField(member.LastPaymentDate),
+		"Last Contribution Email Date":  dateField(member.LastContributionEmailDate),
 		"Number of Contributions Email": member.NumberContributionsEmail,
+		"Last Pre-Expiry Email Date":    dateField(member.LastPreExpiryEmailDate),
+		"Number of Pre-Expiry Emails":   member.NumberPreExpiryEmails,
+		"Last Thanked Order":            member.LastThankedOrder,
+		"Welcome Email Step":            member.WelcomeEmailStep,
+		"Last Welcome Email Date":       dateField(member.LastWelcomeEmailDate),
+		"Undeliverable Emails":          strings.Join(member.UndeliverableEmails, ", "),
+		"Email Opt-Out":                 member.EmailOptOut,
+	}
+}
+
+// dateField formats a date column, nil when the date is empty
+func dateField(date time.Time) interface{} {
+	if date.IsZero() {
+		return nil
+	}
+	return date.Format("2006-01-02")
+}
+
+// writeRows sends a POST or PATCH request to a rows endpoint
+func writeRows(method string, apiURL string, payload any) error {
+	apiToken := os.Getenv("BASEROW_API_TOKEN")
+	if apiToken == "" {
+		return fmt.Errorf("BASEROW_API_TOKEN environment variable must be set")
 	}
 
 	payloadBytes, err := json.Marshal(payload)
@@ -235,7 +400,7 @@ func UpdateMember(member Member) error {
 	}
 
 	client := &http.Client{}
-	req, err := http.NewRequest("PATCH", apiURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequest(method, apiURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		slog.Error("Failed to create update request", "error", err)
 		return err
@@ -253,10 +418,8 @@ func UpdateMember(member Member) error {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		slog.Error("Failed to update member", "status", resp.StatusCode, "response", string(body))
-		return fmt.Errorf("failed to update member: %s, status code: %d", string(body), resp.StatusCode)
+		slog.Error("Failed to write rows", "status", resp.StatusCode, "response", string(body))
+		return fmt.Errorf("%s, status code: %d", string(body), resp.StatusCode)
 	}
-
-	slog.Info("Successfully updated member in Baserow", "id", member.Id, "email", member.Email)
 	return nil
 }
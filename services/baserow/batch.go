@@ -0,0 +1,58 @@
+package baserow
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/samber/lo"
+)
+
+// maxBatchRows is the maximum number of rows Baserow updates in one request
+const maxBatchRows = 200
+
+// UpdateMembers writes the member updates with the batch rows endpoint, up to
+// 200 rows per request. It returns one error per update, nil when the row was
+// written. Baserow rejects a whole batch when one row is invalid, so a
+// rejected batch is retried member by member.
+func UpdateMembers(updates []MemberUpdate) []error {
+	errs := make([]error, len(updates))
+
+	tableID := os.Getenv("BASEROW_MEMBER_TABLE_ID")
+	if tableID == "" {
+		err := fmt.Errorf("BASEROW_MEMBER_TABLE_ID environment variable must be set")
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	apiURL := fmt.Sprintf("https://baserow.boavizta.org/api/database/rows/table/%s/batch/?user_field_names=true", tableID)
+
+	for _, chunk := range lo.Chunk(lo.Range(len(updates)), maxBatchRows) {
+		if len(chunk) == 1 {
+			errs[chunk[0]] = UpdateMember(updates[chunk[0]])
+			continue
+		}
+
+		items := make([]map[string]interface{}, len(chunk))
+		for i, index := range chunk {
+			items[i] = map[string]interface{}{"id": updates[index].Id}
+			for column, value := range updates[index].Fields {
+				items[i][column] = value
+			}
+		}
+
+		slog.Info("Updating members in Baserow", "count", len(chunk))
+		err := writeRows("PATCH", apiURL, map[string]interface{}{"items": items})
+		if err == nil {
+			slog.Info("Successfully updated members in Baserow", "count", len(chunk))
+			continue
+		}
+
+		slog.Warn("Members batch rejected, updating members one by one", "error", err, "count", len(chunk))
+		for _, index := range chunk {
+			errs[index] = UpdateMember(updates[index])
+		}
+	}
+	return errs
+}
@@ -0,0 +1,61 @@
+package baserow
+
+import (
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Override represents a row of the "Membership overrides" table. Overrides
+// protect exceptional memberships (honorary members, board members, partners
+// paying by bank transfer...) from the automatic reconciliation.
+type Override struct {
+	Id              int       `json:"id"`
+	MemberIds       []int     `json:"Member"`
+	Reason          string    `json:"Reason"`
+	ValidUntil      time.Time `json:"Valid Until"`
+	NeverDeactivate bool      `json:"Never Deactivate"`
+	NeverEmail      bool      `json:"Never Email"`
+}
+
+// IsActive reports whether the override applies at the given time.
+// An override without a "Valid Until" date never expires.
+func (o Override) IsActive(now time.Time) bool {
+	if o.ValidUntil.IsZero() {
+		return true
+	}
+	return !o.ValidUntil.Before(now.Truncate(24 * time.Hour))
+}
+
+// GetOverrides fetches all rows of the membership overrides table.
+// The table is optional: when BASEROW_OVERRIDES_TABLE_ID is not set, no
+// override is returned.
+func GetOverrides() ([]Override, error) {
+	tableID := os.Getenv("BASEROW_OVERRIDES_TABLE_ID")
+	if tableID == "" {
+		slog.Debug("BASEROW_OVERRIDES_TABLE_ID not set, skipping membership overrides")
+		return nil, nil
+	}
+
+	slog.Info("Fetching membership overrides from Baserow")
+
+	rows, err := getRows(tableID)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides []Override
+	for _, result := range rows {
+		overrides = append(overrides, Override{
+			Id:              getIntValue(result, "id"),
+			MemberIds:       getMultiSelectIds(result, "Member"),
+			Reason:          getStringValue(result, "Reason"),
+			ValidUntil:      getDateValue(result, "Valid Until"),
+			NeverDeactivate: getBoolValue(result, "Never Deactivate"),
+			NeverEmail:      getBoolValue(result, "Never Email"),
+		})
+	}
+
+	slog.Info("Successfully fetched membership overrides from Baserow", "count", len(overrides))
+	return overrides, nil
+}
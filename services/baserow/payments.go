@@ -0,0 +1,63 @@
+package baserow
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ManualPayment represents a row of the "Manual payments" table, used to
+// record payments made outside HelloAsso (e.g. bank transfers).
+type ManualPayment struct {
+	Id        int       `json:"id"`
+	Email     string    `json:"E-mail"`
+	Name      string    `json:"Name"`
+	Date      time.Time `json:"Date"`
+	Amount    float64   `json:"Amount"`
+	Reference string    `json:"Reference"`
+}
+
+// GetManualPayments fetches all rows of the manual payments table
+func GetManualPayments() ([]ManualPayment, error) {
+	tableID := os.Getenv("BASEROW_MANUAL_PAYMENTS_TABLE_ID")
+	if tableID == "" {
+		return nil, fmt.Errorf("BASEROW_MANUAL_PAYMENTS_TABLE_ID environment variable must be set")
+	}
+
+	slog.Info("Fetching manual payments from Baserow")
+
+	rows, err := getRows(tableID)
+	if err != nil {
+		return nil, err
+	}
+
+	var payments []ManualPayment
+	for _, result := range rows {
+		payments = append(payments, ManualPayment{
+			Id:        getIntValue(result, "id"),
+			Email:     getStringValue(result, "E-mail"),
+			Name:      getStringValue(result, "Name"),
+			Date:      getDateValue(result, "Date"),
+			Amount:    getDecimalValue(result, "Amount"),
+			Reference: getStringValue(result, "Reference"),
+		})
+	}
+
+	slog.Info("Successfully fetched manual payments from Baserow", "count", len(payments))
+	return payments, nil
+}
+
+// getDecimalValue reads a number field, Baserow serializes decimals as strings
+func getDecimalValue(data map[string]interface{}, key string) float64 {
+	switch val := data[key].(type) {
+	case float64:
+		return val
+	case string:
+		if number, err := strconv.ParseFloat(val, 64); err == nil {
+			return number
+		}
+	}
+	return 0
+}
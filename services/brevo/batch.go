@@ -0,0 +1,184 @@
+package brevo
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// maxMessageVersions is the maximum number of message versions Brevo accepts
+// in one request
+const maxMessageVersions = 1000
+
+// maxBatchRecipients is the maximum number of recipients, to and cc of every
+// version, Brevo accepts in one request
+const maxBatchRecipients = 2000
+
+// mailinCustomHeader identifies an email in the Brevo events. It can't differ
+// between message versions, so batched emails carry it in their params.
+const mailinCustomHeader = "X-Mailin-custom"
+
+// MessageVersion is one recipient of a batch request, with its own params
+// and content
+type MessageVersion struct {
+	To          []Recipient    `json:"to"`
+	Cc          []Recipient    `json:"cc,omitempty"`
+	Params      map[string]any `json:"params,omitempty"`
+	Subject     string         `json:"subject,omitempty"`
+	HtmlContent string         `json:"htmlContent,omitempty"`
+	TextContent string         `json:"textContent,omitempty"`
+	ReplyTo     *Recipient     `json:"replyTo,omitempty"`
+}
+
+// SendBatch sends the emails with as few requests as possible: emails sharing
+// the sender, the template, the tags, the headers and the schedule are sent
+// together as message versions. The X-Mailin-custom header of each email is
+// passed as the "mailinCustom" param of its version, since Brevo doesn't
+// accept headers per version. It returns one error per email, nil when Brevo
+// accepted it. A batch Brevo rejected as invalid is retried email by email, so
+// that one invalid recipient doesn't fail the others. Any other error fails the
+// whole batch: Brevo may have accepted it, retrying could email members twice.
+func SendBatch(emails []EmailData) []error {
+	errs := make([]error, len(emails))
+
+	apiKey := os.Getenv("BREVO_API_KEY")
+	if apiKey == "" {
+		err := fmt.Errorf("BREVO_API_KEY environment variable must be set")
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	groups := lo.GroupBy(lo.Range(len(emails)), func(i int) string {
+		email := emails[i]
+		return strings.Join([]string{strconv.Itoa(email.TemplateId), email.SenderName, email.SenderEmail, strings.Join(email.Tags, ","), headersKey(sharedHeaders(email)), email.ScheduledAt.String()}, "|")
+	})
+
+	for _, indexes := range groups {
+		for _, chunk := range batchChunks(emails, indexes) {
+			if len(chunk) == 1 {
+				errs[chunk[0]] = SendEmail(emails[chunk[0]])
+				continue
+			}
+
+			slog.Info("Preparing to send email batch", "count", len(chunk), "templateId", emails[chunk[0]].TemplateId)
+			err := postEmail(apiKey, batchRequest(emails, chunk))
+			if err == nil {
+				slog.Info("Email batch sent successfully", "count", len(chunk))
+				continue
+			}
+
+			if !errors.Is(err, errInvalidRequest) {
+				slog.Error("Email batch failed, not retried", "error", err, "count", len(chunk))
+				for _, i := range chunk {
+					errs[i] = err
+				}
+				continue
+			}
+
+			slog.Warn("Email batch rejected, sending emails one by one", "error", err, "count", len(chunk))
+			for _, i := range chunk {
+				errs[i] = SendEmail(emails[i])
+			}
+		}
+	}
+	return errs
+}
+
+// batchChunks splits the emails at indexes into requests within the Brevo
+// limits of message versions and recipients
+func batchChunks(emails []EmailData, indexes []int) [][]int {
+	var chunks [][]int
+	var chunk []int
+	recipients := 0
+	for _, i := range indexes {
+		count := 1 + len(emails[i].Cc)
+		if len(chunk) > 0 && (len(chunk) == maxMessageVersions || recipients+count > maxBatchRecipients) {
+			chunks = append(chunks, chunk)
+			chunk, recipients = nil, 0
+		}
+		chunk = append(chunk, i)
+		recipients += count
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// batchRequest builds the request sending the emails at indexes as message
+// versions. The first email provides the shared content, which Brevo
+// requires even though every version overrides it.
+func batchRequest(emails []EmailData, indexes []int) SendEmailRequest {
+	first := emails[indexes[0]]
+	reqBody := SendEmailRequest{
+		Sender: Sender{
+			Name:  first.SenderName,
+			Email: first.SenderEmail,
+		},
+		Subject:     first.Subject,
+		HtmlContent: first.HtmlContent,
+		TextContent: first.TextContent,
+		TemplateId:  first.TemplateId,
+		Tags:        first.Tags,
+		Headers:     sharedHeaders(first),
+	}
+	if !first.ScheduledAt.IsZero() {
+		reqBody.ScheduledAt = first.ScheduledAt.Format(time.RFC3339)
+	}
+
+	for _, i := range indexes {
+		email := emails[i]
+		version := MessageVersion{
+			To:          []Recipient{{Email: email.ToEmail, Name: email.ToName}},
+			Cc:          ccRecipients(email.Cc),
+			Params:      versionParams(email),
+			Subject:     email.Subject,
+			HtmlContent: email.HtmlContent,
+			TextContent: email.TextContent,
+		}
+		if email.ReplyToEmail != "" {
+			version.ReplyTo = &Recipient{Email: email.ReplyToEmail, Name: email.ReplyToName}
+		}
+		reqBody.MessageVersions = append(reqBody.MessageVersions, version)
+	}
+	return reqBody
+}
+
+// sharedHeaders returns the headers of the email common to a batch, every
+// header but X-Mailin-custom
+func sharedHeaders(email EmailData) map[string]string {
+	headers := lo.OmitByKeys(email.Headers, []string{mailinCustomHeader})
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
+
+// headersKey identifies a set of headers in the batch grouping key
+func headersKey(headers map[string]string) string {
+	return strings.Join(lo.Map(slices.Sorted(maps.Keys(headers)), func(name string, _ int) string {
+		return name + "=" + headers[name]
+	}), ",")
+}
+
+// versionParams returns the params of the email with its X-Mailin-custom
+// header, if any
+func versionParams(email EmailData) map[string]any {
+	custom, ok := email.Headers[mailinCustomHeader]
+	if !ok {
+		return email.Params
+	}
+	params := lo.Assign(email.Params)
+	params["mailinCustom"] = custom
+	return params
+}
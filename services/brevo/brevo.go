@@ -3,31 +3,54 @@ package brevo
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"time"
 )
 
-// EmailData represents the data needed to send an email
+// EmailData represents the data needed to send an email. Either the content
+// (Subject, HtmlContent, TextContent) or a Brevo TemplateId with its Params is
+// set; Subject then overrides the template subject when not empty.
 type EmailData struct {
-	SenderName  string
-	SenderEmail string
-	ToEmail     string
-	ToName      string
-	Subject     string
-	HtmlContent string
-	TextContent string
+	SenderName   string
+	SenderEmail  string
+	ToEmail      string
+	ToName       string
+	Cc           []string
+	Subject      string
+	HtmlContent  string
+	TextContent  string
+	TemplateId   int
+	Params       map[string]any
+	Tags         []string
+	ReplyToEmail string
+	ReplyToName  string
+	Headers      map[string]string
+	// ScheduledAt delays the delivery, Brevo accepts up to 72 hours ahead
+	ScheduledAt time.Time
 }
 
 // SendEmailRequest represents the request body for the Brevo API
 type SendEmailRequest struct {
-	Sender      Sender      `json:"sender"`
-	To          []Recipient `json:"to"`
-	Subject     string      `json:"subject"`
-	HtmlContent string      `json:"htmlContent"`
-	TextContent string      `json:"textContent"`
+	Sender      Sender            `json:"sender"`
+	To          []Recipient       `json:"to,omitempty"`
+	Cc          []Recipient       `json:"cc,omitempty"`
+	Subject     string            `json:"subject,omitempty"`
+	HtmlContent string            `json:"htmlContent,omitempty"`
+	TextContent string            `json:"textContent,omitempty"`
+	TemplateId  int               `json:"templateId,omitempty"`
+	Params      map[string]any    `json:"params,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	ReplyTo     *Recipient        `json:"replyTo,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ScheduledAt string            `json:"scheduledAt,omitempty"`
+	// MessageVersions sends one email per version in a single request, see
+	// SendBatch
+	MessageVersions []MessageVersion `json:"messageVersions,omitempty"`
 }
 
 // Sender represents the email sender
@@ -39,7 +62,16 @@ type Sender struct {
 // Recipient represents an email recipient
 type Recipient struct {
 	Email string `json:"email"`
-	Name  string `json:"name"`
+	Name  string `json:"name,omitempty"`
+}
+
+// ccRecipients converts CC addresses to recipients
+func ccRecipients(emails []string) []Recipient {
+	var recipients []Recipient
+	for _, email := range emails {
+		recipients = append(recipients, Recipient{Email: email})
+	}
+	return recipients
 }
 
 // SendEmail sends an email using the Brevo API
@@ -49,7 +81,7 @@ func SendEmail(data EmailData) error {
 		return fmt.Errorf("BREVO_API_KEY environment variable must be set")
 	}
 
-	slog.Info("Preparing to send email", "to", data.ToEmail)
+	slog.Info("Preparing to send email", "to", data.ToEmail, "templateId", data.TemplateId)
 
 	// Prepare the request body
 	reqBody := SendEmailRequest{
@@ -63,11 +95,36 @@ func SendEmail(data EmailData) error {
 				Name:  data.ToName,
 			},
 		},
+		Cc:          ccRecipients(data.Cc),
 		Subject:     data.Subject,
 		HtmlContent: data.HtmlContent,
 		TextContent: data.TextContent,
+		TemplateId:  data.TemplateId,
+		Params:      data.Params,
+		Tags:        data.Tags,
+		Headers:     data.Headers,
+	}
+	if data.ReplyToEmail != "" {
+		reqBody.ReplyTo = &Recipient{Email: data.ReplyToEmail, Name: data.ReplyToName}
+	}
+	if !data.ScheduledAt.IsZero() {
+		reqBody.ScheduledAt = data.ScheduledAt.Format(time.RFC3339)
+	}
+
+	if err := postEmail(apiKey, reqBody); err != nil {
+		return err
 	}
 
+	slog.Info("Email sent successfully", "to", data.ToEmail)
+	return nil
+}
+
+// errInvalidRequest is returned when Brevo rejected the request as invalid, so
+// that no email of it was sent
+var errInvalidRequest = errors.New("failed to send email")
+
+// postEmail posts a request to the transactional email endpoint
+func postEmail(apiKey string, reqBody SendEmailRequest) error {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		slog.Error("Failed to marshal request body", "error", err)
@@ -98,9 +155,10 @@ func SendEmail(data EmailData) error {
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(resp.Body)
 		slog.Error("Failed to send email", "status", resp.StatusCode, "response", string(body))
+		if resp.StatusCode == http.StatusBadRequest {
+			return fmt.Errorf("%w: %s, status code: %d", errInvalidRequest, string(body), resp.StatusCode)
+		}
 		return fmt.Errorf("failed to send email: %s, status code: %d", string(body), resp.StatusCode)
 	}
-
-	slog.Info("Email sent successfully", "to", data.ToEmail)
 	return nil
 }
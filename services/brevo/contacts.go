@@ -0,0 +1,163 @@
+package brevo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/samber/lo"
+)
+
+// Batch sizes of the contacts endpoints
+const (
+	importContactsBatchSize = 1000
+	removeContactsBatchSize = 150
+	listContactsPageSize    = 500
+)
+
+// Contact is a Brevo contact with its attributes (FIRSTNAME, LASTNAME...)
+type Contact struct {
+	Email      string         `json:"email"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// ImportContactsRequest represents the request body of the contacts import
+type ImportContactsRequest struct {
+	JsonBody                []Contact `json:"jsonBody"`
+	ListIds                 []int     `json:"listIds"`
+	UpdateExistingContacts  bool      `json:"updateExistingContacts"`
+	EmptyContactsAttributes bool      `json:"emptyContactsAttributes"`
+}
+
+// ListContactsResponse represents the API response for the contacts of a list
+type ListContactsResponse struct {
+	Contacts []struct {
+		Email string `json:"email"`
+	} `json:"contacts"`
+	Count int `json:"count"`
+}
+
+// ImportContacts creates or updates the contacts and adds them to the list,
+// in batches. Brevo processes imports asynchronously.
+func ImportContacts(listId int, contacts []Contact) error {
+	for _, batch := range lo.Chunk(contacts, importContactsBatchSize) {
+		slog.Info("Importing contacts to Brevo", "list", listId, "count", len(batch))
+		reqBody := ImportContactsRequest{
+			JsonBody:               batch,
+			ListIds:                []int{listId},
+			UpdateExistingContacts: true,
+		}
+		if err := postContacts("https://api.sendinblue.com/v3/contacts/import", reqBody); err != nil {
+			return fmt.Errorf("failed to import contacts to list %d: %w", listId, err)
+		}
+	}
+	return nil
+}
+
+// RemoveContactsFromList removes the contacts from the list, in batches. The
+// contacts themselves are kept.
+func RemoveContactsFromList(listId int, emails []string) error {
+	for _, batch := range lo.Chunk(emails, removeContactsBatchSize) {
+		slog.Info("Removing contacts from Brevo list", "list", listId, "count", len(batch))
+		url := fmt.Sprintf("https://api.sendinblue.com/v3/contacts/lists/%d/contacts/remove", listId)
+		if err := postContacts(url, map[string][]string{"emails": batch}); err != nil {
+			return fmt.Errorf("failed to remove contacts from list %d: %w", listId, err)
+		}
+	}
+	return nil
+}
+
+// GetListContacts fetches the emails of the contacts of a list, following
+// pagination
+func GetListContacts(listId int) ([]string, error) {
+	apiKey := os.Getenv("BREVO_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("BREVO_API_KEY environment variable must be set")
+	}
+
+	client := &http.Client{}
+	var emails []string
+
+	for offset := 0; ; offset += listContactsPageSize {
+		url := fmt.Sprintf("https://api.sendinblue.com/v3/contacts/lists/%d/contacts?limit=%d&offset=%d", listId, listContactsPageSize, offset)
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			slog.Error("Failed to create request", "error", err)
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("api-key", apiKey)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			slog.Error("Failed to send request", "error", err)
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			slog.Error("Failed to get list contacts", "list", listId, "status", resp.StatusCode, "response", string(body))
+			return nil, fmt.Errorf("failed to get contacts of list %d: %s, status code: %d", listId, string(body), resp.StatusCode)
+		}
+
+		var contactsResp ListContactsResponse
+		if err := json.NewDecoder(resp.Body).Decode(&contactsResp); err != nil {
+			resp.Body.Close()
+			slog.Error("Failed to decode response", "error", err)
+			return nil, err
+		}
+		resp.Body.Close()
+
+		for _, contact := range contactsResp.Contacts {
+			emails = append(emails, contact.Email)
+		}
+		if len(contactsResp.Contacts) < listContactsPageSize {
+			break
+		}
+	}
+
+	slog.Info("Successfully fetched list contacts from Brevo", "list", listId, "count", len(emails))
+	return emails, nil
+}
+
+// postContacts posts a request to a contacts endpoint
+func postContacts(url string, reqBody any) error {
+	apiKey := os.Getenv("BREVO_API_KEY")
+	if apiKey == "" {
+		return fmt.Errorf("BREVO_API_KEY environment variable must be set")
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		slog.Error("Failed to marshal request body", "error", err)
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		slog.Error("Failed to create request", "error", err)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api-key", apiKey)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Error("Failed to send request", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		slog.Error("Failed to update contacts", "status", resp.StatusCode, "response", string(body))
+		return fmt.Errorf("%s, status code: %d", string(body), resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package brevo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// eventsPageSize is the maximum number of events returned by one request
+const eventsPageSize = 2500
+
+// Event is a transactional email event, e.g. a hard bounce
+type Event struct {
+	Email     string    `json:"email"`
+	Date      time.Time `json:"date"`
+	MessageId string    `json:"messageId"`
+	Event     string    `json:"event"`
+	Reason    string    `json:"reason"`
+	Tag       string    `json:"tag"`
+}
+
+// EventsResponse represents the API response for transactional email events
+type EventsResponse struct {
+	Events []Event `json:"events"`
+}
+
+// GetEvents fetches the transactional email events of the given type
+// (hardBounces, blocked, invalid, spam, unsubscribed...) of the last days,
+// following pagination
+func GetEvents(eventType string, days int) ([]Event, error) {
+	apiKey := os.Getenv("BREVO_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("BREVO_API_KEY environment variable must be set")
+	}
+
+	slog.Info("Fetching email events from Brevo", "event", eventType, "days", days)
+
+	client := &http.Client{}
+	var events []Event
+
+	for offset := 0; ; offset += eventsPageSize {
+		query := url.Values{
+			"event":  {eventType},
+			"days":   {strconv.Itoa(days)},
+			"limit":  {strconv.Itoa(eventsPageSize)},
+			"offset": {strconv.Itoa(offset)},
+			"sort":   {"asc"},
+		}
+		req, err := http.NewRequest("GET", "https://api.sendinblue.com/v3/smtp/statistics/events?"+query.Encode(), nil)
+		if err != nil {
+			slog.Error("Failed to create request", "error", err)
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("api-key", apiKey)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			slog.Error("Failed to send request", "error", err)
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			slog.Error("Failed to get email events", "status", resp.StatusCode, "response", string(body))
+			return nil, fmt.Errorf("failed to get %s email events: %s, status code: %d", eventType, string(body), resp.StatusCode)
+		}
+
+		var eventsResp EventsResponse
+		if err := json.NewDecoder(resp.Body).Decode(&eventsResp); err != nil {
+			resp.Body.Close()
+			slog.Error("Failed to decode response", "error", err)
+			return nil, err
+		}
+		resp.Body.Close()
+
+		events = append(events, eventsResp.Events...)
+		if len(eventsResp.Events) < eventsPageSize {
+			break
+		}
+	}
+
+	slog.Info("Successfully fetched email events from Brevo", "event", eventType, "count", len(events))
+	return events, nil
+}
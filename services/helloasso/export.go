@@ -0,0 +1,251 @@
+package helloasso
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// exportColumns lists, for each field we need, the headers used by the
+// HelloAsso back-office exports (payments export and items/members export,
+// French and English back-office). Headers are compared once normalized,
+// see normalizeHeader. The first header found in the file wins.
+var exportColumns = map[string][]string{
+	"orderId":   {"reference commande", "numero de commande", "order reference", "order number", "order id"},
+	"date":      {"date de la commande", "date du paiement", "order date", "payment date", "date"},
+	"email":     {"email payeur", "payer email", "e-mail payeur", "email", "e-mail"},
+	"firstName": {"prenom payeur", "payer first name", "prenom adherent", "first name", "prenom"},
+	"lastName":  {"nom payeur", "payer last name", "nom adherent", "last name", "nom"},
+	"country":   {"pays payeur", "payer country", "pays", "country"},
+	"amount":    {"montant du tarif", "tier amount", "montant total", "total amount", "montant", "amount"},
+	"status":    {"statut de la commande", "statut du paiement", "order status", "payment status", "statut", "status"},
+	"formSlug":  {"slug du formulaire", "form slug", "slug"},
+	"formName":  {"formulaire", "nom de la campagne", "campagne", "form name", "form", "campaign"},
+}
+
+// skippedExportStatuses lists status prefixes of refunded or failed payments,
+// which are excluded from the export like they are from the API calls.
+var skippedExportStatuses = []string{"rembours", "refund", "annul", "cancel", "refus", "fail", "echou", "abandon"}
+
+// ParseExportFile reads a HelloAsso back-office export (payments or items
+// export, as CSV or Excel file) and returns the payments it contains, so the
+// reconciliation can run without the API.
+func ParseExportFile(path string) ([]Payment, error) {
+	slog.Info("Parsing HelloAsso export file", "file", path)
+
+	var records [][]string
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xlsx":
+		records, err = readXlsx(path)
+	case ".csv", ".txt":
+		records, err = readExportCsv(path)
+	default:
+		return nil, fmt.Errorf("unsupported export file %s, expected .csv or .xlsx", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("export file %s is empty", path)
+	}
+
+	columns := mapExportColumns(records[0])
+	for _, required := range []string{"date", "email", "amount"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("export file %s: no %s column found in header %v", path, required, records[0])
+		}
+	}
+
+	value := func(record []string, field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var payments []Payment
+	for line, record := range records[1:] {
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		status := normalizeHeader(value(record, "status"))
+		if isSkippedExportStatus(status) {
+			slog.Debug("Skipping export line with status", "line", line+2, "status", status)
+			continue
+		}
+
+		date, err := parseExportDate(value(record, "date"))
+		if err != nil {
+			return nil, fmt.Errorf("export file %s line %d: %w", path, line+2, err)
+		}
+		amount, err := parseExportAmount(value(record, "amount"))
+		if err != nil {
+			return nil, fmt.Errorf("export file %s line %d: %w", path, line+2, err)
+		}
+
+		formSlug := value(record, "formSlug")
+		if formSlug == "" {
+			formSlug = slugify(value(record, "formName"))
+		}
+
+		// Order references are numeric HelloAsso order IDs
+		orderId, _ := strconv.Atoi(value(record, "orderId"))
+
+		payments = append(payments, Payment{
+			OrderId:        orderId,
+			OrderFormSlug:  formSlug,
+			OrderDate:      date,
+			PayerEmail:     value(record, "email"),
+			PayerFirstName: value(record, "firstName"),
+			PayerLastName:  value(record, "lastName"),
+			PayerCountry:   value(record, "country"),
+			Amount:         amount,
+		})
+	}
+
+	slog.Info("Finished parsing HelloAsso export file", "file", path, "total", len(payments))
+	return payments, nil
+}
+
+// readExportCsv reads a CSV export. HelloAsso uses ";" as separator, but files
+// re-saved from a spreadsheet may use ",": the separator is guessed from the
+// header line.
+func readExportCsv(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buffered := bufio.NewReader(f)
+	header, err := buffered.Peek(4096)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	firstLine, _, _ := strings.Cut(string(header), "\n")
+
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if strings.Count(firstLine, ";") > strings.Count(firstLine, ",") {
+		reader.Comma = ';'
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(records) > 0 && len(records[0]) > 0 {
+		records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+	}
+	return records, nil
+}
+
+// mapExportColumns returns the index of each known field in the header
+func mapExportColumns(header []string) map[string]int {
+	normalized := make([]string, len(header))
+	for i, name := range header {
+		normalized[i] = normalizeHeader(name)
+	}
+
+	columns := map[string]int{}
+	for field, aliases := range exportColumns {
+	aliasLoop:
+		for _, alias := range aliases {
+			for i, name := range normalized {
+				if name == alias {
+					columns[field] = i
+					break aliasLoop
+				}
+			}
+		}
+	}
+	return columns
+}
+
+// normalizeHeader lowercases and removes accents, so that "Prénom payeur"
+// and "prenom payeur" are the same header.
+func normalizeHeader(value string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	result, _, err := transform.String(t, value)
+	if err != nil {
+		result = value
+	}
+	return strings.ToLower(strings.Join(strings.Fields(result), " "))
+}
+
+// slugify builds a HelloAsso-like form slug from a form name,
+// e.g. "Cotisation annuelle" becomes "cotisation-annuelle".
+func slugify(value string) string {
+	var builder strings.Builder
+	for _, word := range strings.FieldsFunc(normalizeHeader(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if builder.Len() > 0 {
+			builder.WriteString("-")
+		}
+		builder.WriteString(word)
+	}
+	return builder.String()
+}
+
+func isSkippedExportStatus(status string) bool {
+	for _, skipped := range skippedExportStatuses {
+		if strings.HasPrefix(status, skipped) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExportDate reads the dates found in exports. Excel files may also store
+// dates as a serial number of days since 1899-12-30.
+func parseExportDate(value string) (time.Time, error) {
+	for _, layout := range []string{"02/01/2006 15:04:05", "02/01/2006 15:04", "02/01/2006", "2006-01-02 15:04:05", "2006-01-02", time.RFC3339} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 {
+		days, fraction := math.Modf(serial)
+		date := time.Date(1899, 12, 30, 0, 0, 0, 0, time.Local).AddDate(0, 0, int(days))
+		return date.Add(time.Duration(fraction * float64(24*time.Hour))), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// parseExportAmount reads amounts such as "50", "50,00" or "50,00 €"
+func parseExportAmount(value string) (float64, error) {
+	cleaned := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "€"))
+	cleaned = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, cleaned)
+	cleaned = strings.ReplaceAll(cleaned, ",", ".")
+	if cleaned == "" {
+		return 0, nil
+	}
+	amount, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
@@ -0,0 +1,164 @@
+package helloasso
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// paymentsExportCsv is an anonymized payments export of the French
+// back-office: ";" separated, with a BOM and a refunded order
+const paymentsExportCsv = "\ufeff" +
+	"Référence commande;Date du paiement;Email payeur;Prénom payeur;Nom payeur;Pays payeur;Montant;Statut du paiement;Formulaire\n" +
+	"101;15/01/2026 10:30;alice@example.org;Alice;Martin;FRA;50,00 €;Autorisé;Adhésion 2026\n" +
+	"102;16/01/2026 11:00;bob@example.com;Bob;Durand;BEL;1 000,00 €;Remboursé;Adhésion 2026\n" +
+	"103;17/01/2026;carol@example.net;Carol;Petit;FRA;0;Autorisé;Adhésion 2026\n"
+
+// itemsExportCsv is an anonymized items export of the English back-office,
+// re-saved with "," as separator
+const itemsExportCsv = "Order number,Order date,Payer email,Payer first name,Payer last name,Tier amount,Order status,Form slug\n" +
+	"201,2026-02-01 09:15:00,dave@example.org,Dave,Lee,25.5,Validated,membership-2026\n" +
+	",,,,,,,\n" +
+	"202,2026-02-03,erin@example.org,Erin,Moss,100,Cancelled,membership-2026\n"
+
+func TestParseExportFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  func(t *testing.T, path string)
+		expected []Payment
+	}{
+		{
+			name:    "payments export",
+			file:    "payments.csv",
+			content: writeFile(paymentsExportCsv),
+			expected: []Payment{
+				{OrderId: 101, OrderFormSlug: "adhesion-2026", OrderDate: time.Date(2026, 1, 15, 10, 30, 0, 0, time.Local), PayerEmail: "alice@example.org", PayerFirstName: "Alice", PayerLastName: "Martin", PayerCountry: "FRA", Amount: 50},
+				{OrderId: 103, OrderFormSlug: "adhesion-2026", OrderDate: time.Date(2026, 1, 17, 0, 0, 0, 0, time.Local), PayerEmail: "carol@example.net", PayerFirstName: "Carol", PayerLastName: "Petit", PayerCountry: "FRA", Amount: 0},
+			},
+		},
+		{
+			name:    "items export",
+			file:    "items.csv",
+			content: writeFile(itemsExportCsv),
+			expected: []Payment{
+				{OrderId: 201, OrderFormSlug: "membership-2026", OrderDate: time.Date(2026, 2, 1, 9, 15, 0, 0, time.Local), PayerEmail: "dave@example.org", PayerFirstName: "Dave", PayerLastName: "Lee", Amount: 25.5},
+			},
+		},
+		{
+			name: "excel payments export",
+			file: "payments.xlsx",
+			content: writeXlsx([][]string{
+				{"Référence commande", "Date du paiement", "Email payeur", "Prénom payeur", "Nom payeur", "Montant", "Statut du paiement", "Formulaire"},
+				// Excel stores dates as serial numbers, 46037.5 is 2026-01-15 12:00
+				{"101", "46037.5", "alice@example.org", "Alice", "Martin", "50", "Autorisé", "Adhésion 2026"},
+				{"102", "46038", "bob@example.com", "Bob", "Durand", "30", "Refusé", "Adhésion 2026"},
+			}),
+			expected: []Payment{
+				{OrderId: 101, OrderFormSlug: "adhesion-2026", OrderDate: time.Date(2026, 1, 15, 12, 0, 0, 0, time.Local), PayerEmail: "alice@example.org", PayerFirstName: "Alice", PayerLastName: "Martin", Amount: 50},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.file)
+			test.content(t, path)
+
+			payments, err := ParseExportFile(path)
+			if err != nil {
+				t.Fatalf("ParseExportFile() error = %v", err)
+			}
+			if len(payments) != len(test.expected) {
+				t.Fatalf("ParseExportFile() returned %d payments, expected %d: %+v", len(payments), len(test.expected), payments)
+			}
+			for i, expected := range test.expected {
+				actual := payments[i]
+				if !actual.OrderDate.Equal(expected.OrderDate) {
+					t.Errorf("payment %d: OrderDate = %v, expected %v", i, actual.OrderDate, expected.OrderDate)
+				}
+				actual.OrderDate, expected.OrderDate = time.Time{}, time.Time{}
+				if actual != expected {
+					t.Errorf("payment %d = %+v, expected %+v", i, actual, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestParseExportFileMissingColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payments.csv")
+	writeFile("Reference commande;Email payeur\n101;alice@example.org\n")(t, path)
+
+	if _, err := ParseExportFile(path); err == nil {
+		t.Fatal("ParseExportFile() expected an error for an export without date and amount columns")
+	}
+}
+
+// writeFile writes content to the fixture path
+func writeFile(content string) func(t *testing.T, path string) {
+	return func(t *testing.T, path string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeXlsx writes the rows as the first sheet of a minimal Excel file: the
+// header as shared strings, the other cells as inline strings, except
+// numbers which are stored as values
+func writeXlsx(rows [][]string) func(t *testing.T, path string) {
+	return func(t *testing.T, path string) {
+		var sharedStrings, sheet strings.Builder
+		sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+		for r, row := range rows {
+			fmt.Fprintf(&sheet, `<row r="%d">`, r+1)
+			for c, value := range row {
+				reference := fmt.Sprintf("%c%d", 'A'+c, r+1)
+				switch {
+				case r == 0:
+					fmt.Fprintf(&sharedStrings, `<si><t>%s</t></si>`, value)
+					fmt.Fprintf(&sheet, `<c r="%s" t="s"><v>%d</v></c>`, reference, c)
+				case strings.Trim(value, "0123456789.") == "":
+					fmt.Fprintf(&sheet, `<c r="%s"><v>%s</v></c>`, reference, value)
+				default:
+					fmt.Fprintf(&sheet, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, reference, value)
+				}
+			}
+			sheet.WriteString(`</row>`)
+		}
+		sheet.WriteString(`</sheetData></worksheet>`)
+
+		parts := map[string]string{
+			"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+				`<sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+			"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+				`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/export.xml"/></Relationships>`,
+			"xl/sharedStrings.xml":     `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + sharedStrings.String() + `</sst>`,
+			"xl/worksheets/export.xml": sheet.String(),
+		}
+
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		archive := zip.NewWriter(file)
+		for name, content := range parts {
+			writer, err := archive.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := writer.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -23,12 +24,27 @@ type TokenResponse struct {
 
 // Payment represents the payment data we're interested in
 type Payment struct {
+	OrderId        int       `json:"orderId"`
 	OrderFormSlug  string    `json:"orderFormSlug"`
 	OrderDate      time.Time `json:"orderDate"`
 	PayerEmail     string    `json:"payerEmail"`
 	PayerFirstName string    `json:"payerFirstName"`
 	PayerLastName  string    `json:"payerLastName"`
 	Amount         float64   `json:"payerAmount"`
+	// PayerCountry is the ISO 3166-1 alpha-3 country of the payer (e.g. "FRA")
+	PayerCountry string `json:"payerCountry"`
+	// Reference identifies payments made outside HelloAsso (bank transfer
+	// reference, manual payment row...), empty for HelloAsso payments.
+	Reference string `json:"reference"`
+}
+
+// Key identifies the order of the payment: the HelloAsso order ID, or the
+// reference of payments made outside HelloAsso.
+func (p Payment) Key() string {
+	if p.OrderId != 0 {
+		return strconv.Itoa(p.OrderId)
+	}
+	return p.Reference
 }
 
 // PaymentResponse represents the API response for payments
@@ -210,11 +226,13 @@ func GetPayments() ([]Payment, error) {
 		for _, item := range paymentResp.Data {
 
 			payment := Payment{
+				OrderId:        item.Order.ID,
 				OrderFormSlug:  item.Order.FormSlug,
 				OrderDate:      item.Order.Date,
 				PayerEmail:     item.Payer.Email,
 				PayerFirstName: item.Payer.FirstName,
 				PayerLastName:  item.Payer.LastName,
+				PayerCountry:   item.Payer.Country,
 				Amount:         float64(item.Amount) / 100,
 			}
 			allPayments = append(allPayments, payment)
@@ -311,11 +329,13 @@ func GetFreeMembershipItems() ([]Payment, error) {
 			}
 
 			payment := Payment{
+				OrderId:        item.Order.ID,
 				OrderFormSlug:  item.Order.FormSlug,
 				OrderDate:      item.Order.Date,
 				PayerEmail:     item.Payer.Email,
 				PayerFirstName: firstName,
 				PayerLastName:  lastName,
+				PayerCountry:   item.Payer.Country,
 				Amount:         0,
 			}
 			allItems = append(allItems, payment)
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/boavizta/helloasso-renew-contribution/services/helloasso"
+	"github.com/samber/lo"
+)
+
+// offlinePaymentFormSlug is the form slug given to payments made outside
+// HelloAsso, so they go through the same filtering as membership forms.
+const offlinePaymentFormSlug = "offline-membership-fee"
+
+// membershipFormSlugs lists the form slugs of the annual membership payments
+var membershipFormSlugs = map[string]bool{
+	"cotisation-annuelle":   true,
+	"annual-membership-fee": true,
+	offlinePaymentFormSlug:  true,
+}
+
+// PaymentSource provides membership payments to the reconciliation.
+// All sources produce helloasso.Payment values so they go through the same
+// matching and validity logic.
+type PaymentSource interface {
+	Name() string
+	GetPayments() ([]helloasso.Payment, error)
+}
+
+// configuredPaymentSources returns HelloAsso plus the optional offline sources
+// enabled by configuration. When exportFile is set, the HelloAsso API is
+// replaced by that back-office export so the reconciliation can run offline.
+func configuredPaymentSources(exportFile string) []PaymentSource {
+	sources := []PaymentSource{helloAssoSource{}}
+	if exportFile != "" {
+		sources = []PaymentSource{helloAssoExportSource{path: exportFile}}
+	}
+	if file := os.Getenv("PAYMENTS_CSV_FILE"); file != "" {
+		sources = append(sources, csvPaymentSource{path: file})
+	}
+	if os.Getenv("BASEROW_MANUAL_PAYMENTS_TABLE_ID") != "" {
+		sources = append(sources, baserowPaymentSource{})
+	}
+	return sources
+}
+
+// helloAssoSource fetches payments and free memberships from the HelloAsso API
+type helloAssoSource struct{}
+
+func (helloAssoSource) Name() string {
+	return "helloasso"
+}
+
+func (helloAssoSource) GetPayments() ([]helloasso.Payment, error) {
+	payments, err := helloasso.GetPayments()
+	if err != nil {
+		return nil, err
+	}
+
+	freeMemberships, err := helloasso.GetFreeMembershipItems()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(payments, freeMemberships...), nil
+}
+
+// helloAssoExportSource reads payments from a HelloAsso back-office export
+// (payments or items export, CSV or Excel)
+type helloAssoExportSource struct {
+	path string
+}
+
+func (s helloAssoExportSource) Name() string {
+	return "helloasso-export:" + s.path
+}
+
+func (s helloAssoExportSource) GetPayments() ([]helloasso.Payment, error) {
+	return helloasso.ParseExportFile(s.path)
+}
+
+// csvPaymentSource reads offline payments from a CSV file with the columns
+// email, name, date, amount and reference (header required, in any order).
+type csvPaymentSource struct {
+	path string
+}
+
+func (s csvPaymentSource) Name() string {
+	return "csv:" + s.path
+}
+
+func (s csvPaymentSource) GetPayments() ([]helloasso.Payment, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header of %s: %w", s.path, err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"email", "date", "amount"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column %q in %s", required, s.path)
+		}
+	}
+
+	value := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var payments []helloasso.Payment
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+		}
+
+		date, err := parsePaymentDate(value(record, "date"))
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", s.path, line, err)
+		}
+		amount, err := parsePaymentAmount(value(record, "amount"))
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", s.path, line, err)
+		}
+
+		payments = append(payments, offlinePayment(value(record, "email"), value(record, "name"), date, amount, value(record, "reference")))
+	}
+
+	return payments, nil
+}
+
+// baserowPaymentSource reads offline payments from the Baserow
+// "Manual payments" table.
+type baserowPaymentSource struct{}
+
+func (baserowPaymentSource) Name() string {
+	return "baserow-manual-payments"
+}
+
+func (baserowPaymentSource) GetPayments() ([]helloasso.Payment, error) {
+	manualPayments, err := baserow.GetManualPayments()
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.FilterMap(manualPayments, func(manualPayment baserow.ManualPayment, _ int) (helloasso.Payment, bool) {
+		if manualPayment.Email == "" || manualPayment.Date.IsZero() {
+			return helloasso.Payment{}, false
+		}
+		reference := manualPayment.Reference
+		if reference == "" {
+			reference = fmt.Sprintf("manual-payment-%d", manualPayment.Id)
+		}
+		return offlinePayment(manualPayment.Email, manualPayment.Name, manualPayment.Date, manualPayment.Amount, reference), true
+	}), nil
+}
+
+// offlinePayment builds the payment record of a payment made outside HelloAsso
+func offlinePayment(email, name string, date time.Time, amount float64, reference string) helloasso.Payment {
+	firstName, lastName, _ := strings.Cut(strings.TrimSpace(name), " ")
+	return helloasso.Payment{
+		OrderFormSlug:  offlinePaymentFormSlug,
+		OrderDate:      date,
+		PayerEmail:     strings.TrimSpace(email),
+		PayerFirstName: firstName,
+		PayerLastName:  strings.TrimSpace(lastName),
+		Amount:         amount,
+		Reference:      reference,
+	}
+}
+
+// parsePaymentDate accepts ISO (2006-01-02) and French (02/01/2006) dates
+func parsePaymentDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "02/01/2006", time.RFC3339} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid payment date %q", value)
+}
+
+// parsePaymentAmount accepts both "." and "," as decimal separator and an
+// optional euro sign.
+func parsePaymentAmount(value string) (float64, error) {
+	cleaned := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "€"))
+	cleaned = strings.ReplaceAll(cleaned, " ", "")
+	cleaned = strings.ReplaceAll(cleaned, ",", ".")
+	amount, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid payment amount %q", value)
+	}
+	return amount, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/boavizta/helloasso-renew-contribution/services/helloasso"
+)
+
+// WriteFailure is a member change Baserow did not accept
+type WriteFailure struct {
+	Member baserow.Member
+	Err    error
+}
+
+// WriteResult counts the outcome of the member writes
+type WriteResult struct {
+	Written int
+	// Unchanged is the number of planned members identical to the fetched row
+	Unchanged int
+	Failures  []WriteFailure
+}
+
+// MemberConflict records a column set by a phase of the run and changed
+// again by a later phase
+type MemberConflict struct {
+	Member     baserow.Member
+	Column     string
+	Phase      string
+	Value      any
+	LaterPhase string
+	LaterValue any
+}
+
+// columnChange is the last value a phase set to a column, with the payment
+// the phase matched
+type columnChange struct {
+	phase   string
+	value   any
+	payment string
+}
+
+// MemberStates holds the working state of every member during the run. Each
+// phase reads the current state of a member and records its changes, so a
+// phase sees what the previous ones did. Members are written to Baserow once
+// every phase is done, in batches, with only the columns that differ from
+// the fetched row.
+type MemberStates struct {
+	fetched map[int]baserow.Member
+	current map[int]baserow.Member
+	ids     []int
+	updated []int
+	columns map[int]map[string]columnChange
+
+	conflicts []MemberConflict
+}
+
+// newMemberStates starts the working state from the members as fetched from
+// Baserow
+func newMemberStates(fetched []baserow.Member) *MemberStates {
+	states := &MemberStates{
+		fetched: map[int]baserow.Member{},
+		current: map[int]baserow.Member{},
+		columns: map[int]map[string]columnChange{},
+	}
+	for _, member := range fetched {
+		states.fetched[member.Id] = member
+		states.current[member.Id] = member
+		states.ids = append(states.ids, member.Id)
+	}
+	return states
+}
+
+// Current returns the working state of the member
+func (s *MemberStates) Current(member baserow.Member) baserow.Member {
+	if current, ok := s.current[member.Id]; ok {
+		return current
+	}
+	return member
+}
+
+// Members returns the working state of every member, in the fetched order
+func (s *MemberStates) Members() []baserow.Member {
+	members := make([]baserow.Member, len(s.ids))
+	for i, id := range s.ids {
+		members[i] = s.current[id]
+	}
+	return members
+}
+
+// Update records the member changed by the phase, for the matched payment if
+// any. A column already set by an earlier phase and changed again is logged
+// as a conflict; the later phase wins.
+func (s *MemberStates) Update(phase string, member baserow.Member, payment helloasso.Payment, logger *slog.Logger) {
+	// Members a phase updates without any change are still planned, so the
+	// report counts them as unchanged
+	if s.columns[member.Id] == nil {
+		s.columns[member.Id] = map[string]columnChange{}
+		s.updated = append(s.updated, member.Id)
+	}
+
+	changes := baserow.MemberDiff(s.Current(member), member).Fields
+	for column, value := range changes {
+		if previous, ok := s.columns[member.Id][column]; ok && previous.phase != phase {
+			logger.Warn("Member column changed by several phases",
+				"member", member.Email, "column", column,
+				"phase", previous.phase, "value", previous.value,
+				"laterPhase", phase, "laterValue", value,
+			)
+			s.conflicts = append(s.conflicts, MemberConflict{
+				Member: member, Column: column,
+				Phase: previous.phase, Value: previous.value,
+				LaterPhase: phase, LaterValue: value,
+			})
+		}
+		s.columns[member.Id][column] = columnChange{phase: phase, value: value, payment: auditPayment(payment)}
+	}
+	s.current[member.Id] = member
+}
+
+// Conflicts returns the columns changed by several phases
+func (s *MemberStates) Conflicts() []MemberConflict {
+	return s.conflicts
+}
+
+// Flush writes the changed columns of the members updated by the run,
+// skipping the members identical to their fetched row, and adds the written
+// changes to the audit log
+func (s *MemberStates) Flush(audit *AuditLog, logger *slog.Logger) WriteResult {
+	var result WriteResult
+	var members []baserow.Member
+	var updates []baserow.MemberUpdate
+	for _, id := range s.updated {
+		member := s.current[id]
+		update := baserow.MemberDiff(s.fetched[id], member)
+		if len(update.Fields) == 0 {
+			logger.Debug("Member unchanged, not written", "member", member.Email)
+			result.Unchanged++
+			continue
+		}
+		members = append(members, member)
+		updates = append(updates, update)
+	}
+	logger.Info("Writing members to Baserow", "count", len(updates), "unchanged", result.Unchanged)
+
+	var entries []baserow.AuditEntry
+	for i, err := range baserow.UpdateMembers(updates) {
+		if err != nil {
+			logger.Error("Error updating member in Baserow", "error", err, "member", members[i].Email, "id", members[i].Id)
+			result.Failures = append(result.Failures, WriteFailure{Member: members[i], Err: err})
+			continue
+		}
+		result.Written++
+		s.fetched[members[i].Id] = members[i]
+
+		for _, column := range slices.Sorted(maps.Keys(updates[i].Fields)) {
+			change := s.columns[members[i].Id][column]
+			entries = append(entries, baserow.AuditEntry{
+				MemberId: members[i].Id,
+				Email:    members[i].Email,
+				Field:    column,
+				OldValue: updates[i].Previous[column],
+				NewValue: updates[i].Fields[column],
+				Phase:    change.phase,
+				Payment:  change.payment,
+			})
+		}
+	}
+	audit.Add(entries...)
+
+	logger.Info("Finished writing members to Baserow", "written", result.Written, "unchanged", result.Unchanged, "failed", len(result.Failures))
+	s.updated, s.columns = nil, map[int]map[string]columnChange{}
+	return result
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+	"github.com/boavizta/helloasso-renew-contribution/services/helloasso"
+)
+
+// embeddedTemplates holds the default email templates, one directory per
+// language with three files per email: <name>.subject.txt, <name>.html and
+// <name>.txt.
+//
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// TemplateData holds the variables available in the email templates
+type TemplateData struct {
+	// FirstName is the member's first name, capitalized
+	FirstName string
+	Member    baserow.Member
+	Payment   helloasso.Payment
+	// Tier is the membership tier of the payment, see membershipTier
+	Tier        string
+	RenewalLink string
+	// ExpiryDate is the end of the membership period of the payment
+	ExpiryDate time.Time
+	// DaysLeft is the number of days before ExpiryDate (pre-expiry reminders)
+	DaysLeft int
+	// Year is the year of the membership period to come, see membershipYear
+	Year int
+}
+
+// RenderedEmail is the result of rendering an email template
+type RenderedEmail struct {
+	Subject     string
+	HtmlContent string
+	TextContent string
+}
+
+// emailTemplate is one parsed email in one language
+type emailTemplate struct {
+	subject *texttemplate.Template
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+}
+
+// EmailTemplates holds the parsed email templates by language and name.
+// Embedded defaults can be overridden file by file from a directory on disk
+// with the same layout (EMAIL_TEMPLATES_DIR). Emails missing in a language
+// are rendered in the fallback language.
+type EmailTemplates struct {
+	templates map[string]map[string]emailTemplate
+	fallback  string
+}
+
+// templateFuncs are the helpers available in templates, e.g.
+// {{date "02/01/2006" .ExpiryDate}} or {{amount .Payment.Amount}}
+var templateFuncs = map[string]any{
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	"amount": func(amount float64) string {
+		return strconv.FormatFloat(amount, 'f', -1, 64)
+	},
+}
+
+// loadEmailTemplates parses every embedded template, overridden by the files
+// found in dir when it is not empty. All templates are parsed upfront so a
+// broken template stops the run before any email is sent.
+func loadEmailTemplates(dir string, fallback string) (*EmailTemplates, error) {
+	embedded, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]map[string]bool{}
+	if err := collectTemplateNames(embedded, names); err != nil {
+		return nil, err
+	}
+
+	var override fs.FS
+	if dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("invalid email templates directory: %w", err)
+		}
+		override = os.DirFS(dir)
+		if err := collectTemplateNames(override, names); err != nil {
+			return nil, err
+		}
+	}
+
+	readFile := func(lang, file string) (string, error) {
+		name := path.Join(lang, file)
+		if override != nil {
+			content, err := fs.ReadFile(override, name)
+			if err == nil {
+				return string(content), nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+		content, err := fs.ReadFile(embedded, name)
+		if err != nil {
+			return "", fmt.Errorf("missing email template %s", name)
+		}
+		return string(content), nil
+	}
+
+	if names[fallback] == nil {
+		return nil, fmt.Errorf("no email templates for the default language %q", fallback)
+	}
+
+	templates := &EmailTemplates{templates: map[string]map[string]emailTemplate{}, fallback: fallback}
+	for lang, langNames := range names {
+		templates.templates[lang] = map[string]emailTemplate{}
+		for name := range langNames {
+			var parsed emailTemplate
+			var content string
+
+			if content, err = readFile(lang, name+".subject.txt"); err == nil {
+				parsed.subject, err = texttemplate.New(name + ".subject.txt").Funcs(templateFuncs).Parse(content)
+			}
+			if err == nil {
+				if content, err = readFile(lang, name+".html"); err == nil {
+					parsed.html, err = htmltemplate.New(name + ".html").Funcs(templateFuncs).Parse(content)
+				}
+			}
+			if err == nil {
+				if content, err = readFile(lang, name+".txt"); err == nil {
+					parsed.text, err = texttemplate.New(name + ".txt").Funcs(templateFuncs).Parse(content)
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid email template %s/%s: %w", lang, name, err)
+			}
+
+			templates.templates[lang][name] = parsed
+		}
+	}
+
+	return templates, nil
+}
+
+// collectTemplateNames lists the <lang>/<name>.subject.txt files of fsys
+func collectTemplateNames(fsys fs.FS, names map[string]map[string]bool) error {
+	matches, err := fs.Glob(fsys, "*/*.subject.txt")
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		lang, file := path.Split(match)
+		lang = path.Clean(lang)
+		if names[lang] == nil {
+			names[lang] = map[string]bool{}
+		}
+		names[lang][strings.TrimSuffix(file, ".subject.txt")] = true
+	}
+	return nil
+}
+
+// Has reports whether the template exists in the fallback language, which
+// makes it available in every language
+func (t *EmailTemplates) Has(name string) bool {
+	_, ok := t.templates[t.fallback][name]
+	return ok
+}
+
+// Render executes the template of the given language and name, or of the
+// fallback language when the template is not translated
+func (t *EmailTemplates) Render(lang, name string, data TemplateData) (RenderedEmail, error) {
+	parsed, ok := t.templates[lang][name]
+	if !ok {
+		lang = t.fallback
+		parsed, ok = t.templates[lang][name]
+	}
+	if !ok {
+		return RenderedEmail{}, fmt.Errorf("no email template %s/%s", lang, name)
+	}
+
+	var subject, html, text bytes.Buffer
+	if err := parsed.subject.Execute(&subject, data); err != nil {
+		return RenderedEmail{}, fmt.Errorf("failed to render subject of %s/%s: %w", lang, name, err)
+	}
+	if err := parsed.html.Execute(&html, data); err != nil {
+		return RenderedEmail{}, fmt.Errorf("failed to render HTML of %s/%s: %w", lang, name, err)
+	}
+	if err := parsed.text.Execute(&text, data); err != nil {
+		return RenderedEmail{}, fmt.Errorf("failed to render text of %s/%s: %w", lang, name, err)
+	}
+
+	return RenderedEmail{
+		Subject:     strings.TrimSpace(subject.String()),
+		HtmlContent: html.String(),
+		TextContent: text.String(),
+	}, nil
+}
+
+// membershipTier names the membership tier of a payment
+func membershipTier(member baserow.Member, payment helloasso.Payment) string {
+	switch {
+	case payment.Amount == 1000:
+		return "Enterprise"
+	case payment.Amount == 100:
+		return "SME"
+	case member.MembershipType == OrganizationTypeId:
+		return "Organization"
+	case payment.Amount == 0:
+		return "Individual - Free"
+	default:
+		return "Individual"
+	}
+}
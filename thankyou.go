@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+)
+
+// defaultThankYouMaxAgeDays limits thank-you emails to recent payments, so
+// enabling the feature does not thank every member for last year's payment.
+const defaultThankYouMaxAgeDays = 30
+
+// loadThankYouMaxAge returns how old a payment can be to still be thanked,
+// or 0 when thank-you emails are disabled (SEND_THANK_YOU_EMAIL not "true").
+func loadThankYouMaxAge() (time.Duration, error) {
+	if os.Getenv("SEND_THANK_YOU_EMAIL") != "true" {
+		return 0, nil
+	}
+
+	days := defaultThankYouMaxAgeDays
+	if value := os.Getenv("THANK_YOU_MAX_AGE_DAYS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return 0, fmt.Errorf("invalid THANK_YOU_MAX_AGE_DAYS %q", value)
+		}
+		days = parsed
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// planThankYouEmails plans a confirmation and receipt email the first time
+// an order is seen for a member. The thanked order is stored in the
+// "Last Thanked Order" column so reruns never send it twice. Members planned
+// a welcome email, which acknowledges the payment, are skipped.
+func planThankYouEmails(pairs []MemberPaymentPair, maxAge time.Duration, welcomed map[int]bool, states *MemberStates, outbox *Outbox, report *RunReport, logger *slog.Logger) {
+	now := time.Now()
+
+	for _, pair := range pairs {
+		member := states.Current(pair.Member)
+		payment := pair.Payment
+
+		// Free memberships have no payment to acknowledge
+		if payment.Amount == 0 || welcomed[member.Id] {
+			continue
+		}
+		orderKey := payment.Key()
+		if orderKey == "" || orderKey == member.LastThankedOrder {
+			continue
+		}
+		if payment.OrderDate.Before(now.Add(-maxAge)) {
+			continue
+		}
+
+		if report.Overrides.NeverEmail(member.Id) {
+			report.addOverrideDecision(member, "thank-you email not sent")
+			continue
+		}
+		if memberAddress(member) == "" {
+			logger.Debug("No deliverable address, thank-you email not sent", "member", member.Email)
+			continue
+		}
+
+		data := TemplateData{Payment: payment, ExpiryDate: membershipExpiry(payment.OrderDate)}
+		err := outbox.Add("thank-you", data, time.Time{}, member, func(sent *baserow.Member) {
+			sent.LastThankedOrder = orderKey
+		})
+		if err != nil {
+			logger.Error("Error rendering thank-you email", "error", err, "member", member.Email)
+			continue
+		}
+		logger.Debug("Planned thank-you email", "member", member.Email, "order", orderKey)
+	}
+
+	logger.Info("Planned thank-you emails", "count", outbox.Planned())
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/boavizta/helloasso-renew-contribution/services/baserow"
+)
+
+// Steps of the welcome sequence, stored in the "Welcome Email Step" column
+const (
+	welcomeStepNone     = 0
+	welcomeStepWelcome  = 1
+	welcomeStepInvolved = 2
+)
+
+// defaultWelcomeFollowUpDays is the delay between the welcome email and the
+// "how to get involved" email
+const defaultWelcomeFollowUpDays = 7
+
+// loadWelcomeFollowUpDelay returns the delay before the second welcome email,
+// or 0 when the welcome sequence is disabled (SEND_WELCOME_EMAILS not "true").
+func loadWelcomeFollowUpDelay() (time.Duration, error) {
+	if os.Getenv("SEND_WELCOME_EMAILS") != "true" {
+		return 0, nil
+	}
+
+	days := defaultWelcomeFollowUpDays
+	if value := os.Getenv("WELCOME_FOLLOW_UP_DAYS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return 0, fmt.Errorf("invalid WELCOME_FOLLOW_UP_DAYS %q", value)
+		}
+		days = parsed
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// planWelcomeEmails plans the onboarding sequence: a welcome email to members
+// activated for the first time in this run, then a "how to get involved" email
+// once the follow-up delay has passed. It returns the members planned a
+// welcome email, which acknowledges the payment, so they are not thanked too.
+func planWelcomeEmails(firstActivations []MemberPaymentPair, followUpDelay time.Duration, states *MemberStates, welcomeOutbox, involvedOutbox *Outbox, report *RunReport, logger *slog.Logger) map[int]bool {
+	now := time.Now()
+	welcomed := map[int]bool{}
+
+	for _, pair := range firstActivations {
+		member := states.Current(pair.Member)
+		if member.WelcomeEmailStep != welcomeStepNone {
+			continue
+		}
+		if report.Overrides.NeverEmail(member.Id) {
+			report.addOverrideDecision(member, "welcome email not sent")
+			continue
+		}
+		if memberAddress(member) == "" {
+			logger.Debug("No deliverable address, welcome email not sent", "member", member.Email)
+			continue
+		}
+
+		data := TemplateData{Payment: pair.Payment, ExpiryDate: membershipExpiry(pair.Payment.OrderDate)}
+		err := welcomeOutbox.Add("welcome", data, time.Time{}, member, func(sent *baserow.Member) {
+			sent.WelcomeEmailStep = welcomeStepWelcome
+			sent.LastWelcomeEmailDate = now
+			sent.LastThankedOrder = pair.Payment.Key()
+		})
+		if err != nil {
+			logger.Error("Error rendering welcome email", "error", err, "member", member.Email)
+			continue
+		}
+		welcomed[member.Id] = true
+	}
+
+	for _, member := range states.Members() {
+		if member.WelcomeEmailStep != welcomeStepWelcome || !member.ActiveMembership {
+			continue
+		}
+		if member.LastWelcomeEmailDate.After(now.Add(-followUpDelay)) {
+			continue
+		}
+		if report.Overrides.NeverEmail(member.Id) || memberAddress(member) == "" {
+			continue
+		}
+
+		err := involvedOutbox.Add("get-involved", TemplateData{}, time.Time{}, member, func(sent *baserow.Member) {
+			sent.WelcomeEmailStep = welcomeStepInvolved
+			sent.LastWelcomeEmailDate = now
+		})
+		if err != nil {
+			logger.Error("Error rendering get involved email", "error", err, "member", member.Email)
+		}
+	}
+
+	logger.Info("Planned welcome emails", "welcome", welcomeOutbox.Planned(), "getInvolved", involvedOutbox.Planned())
+	return welcomed
+}